@@ -1,11 +1,17 @@
 package sprout
 
 import (
+	"context"
+	"embed"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/wxy365/basal/errs"
@@ -21,12 +27,36 @@ type App[C any] struct {
 	DecryptFns   map[string]func(cipher []byte) ([]byte, error)
 	EncryptFns   map[string]func(plain []byte) ([]byte, error)
 	Initializers []AppInitializer[C]
-	Servers      []*Server
-	Context      C
+	// message bundles of the app, loaded with AddMessageBundle before the servers start
+	MessageBundles []embed.FS
+	// hooks run in order after the initializers and before the servers start listening
+	OnStart []AppHook[C]
+	// hooks run in order once all servers are listening
+	OnReady []AppHook[C]
+	// hooks run in order after all servers have been drained, eg. closing DB pools and message queues
+	OnStop  []AppHook[C]
+	Servers []*Server
+	Context C
 
-	once sync.Once
+	once      sync.Once
+	initOnce  sync.Once
+	initErr   error
+	mu        sync.Mutex
+	started   bool
+	ready     atomic.Bool
+	serving   sync.WaitGroup
+	serveErrs chan error
 }
 
+type AppHook[C any] func(ctx context.Context, app *App[C]) error
+
+// Ready reports whether the app is serving requests, it turns false as soon as the app begins to stop
+func (a *App[C]) Ready() bool {
+	return a.ready.Load()
+}
+
+// Run starts the app and blocks until an interrupt signal is received or any server fails,
+// and then stops the app gracefully. It panics if the app fails to start.
 func (a *App[C]) Run() {
 	a.once.Do(func() {
 		fmt.Print(`
@@ -37,49 +67,180 @@ func (a *App[C]) Run() {
 /____/ .___/_/   \____/\__,_/\__/
     /_/
 `)
-		a.init()
-		for i := len(a.Servers); i > 0; i-- {
-			server := a.Servers[i-1]
-			if i > 1 {
-				go func() {
-					server.start()
-				}()
-			} else {
-				server.start()
-			}
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(quit)
+
+		if err := a.Start(context.Background()); err != nil {
+			log.PanicErr(err)
+		}
+
+		var serveErr error
+		select {
+		case <-quit:
+		case serveErr = <-a.serveErrs:
+		}
+
+		var timeout time.Duration
+		for _, svr := range a.Servers {
+			timeout = max(timeout, svr.ShutdownTimeout)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := a.Stop(ctx); err != nil {
+			log.ErrorErrF("Failed to stop app [{0}] gracefully", err, a.Name)
 		}
+		if serveErr != nil {
+			log.PanicErr(serveErr)
+		}
+	})
+}
+
+// Start initializes the app, runs the OnStart hooks, starts all servers and then runs the OnReady hooks.
+// It returns as soon as all servers are listening. The app is initialized only once, so that it can be
+// started again after Stop without mounting the endpoints of the initializers twice.
+func (a *App[C]) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.started {
+		return errs.New("App [{0}] has already been started", a.Name)
+	}
+
+	a.initOnce.Do(func() {
+		a.initErr = a.init()
 	})
+	if a.initErr != nil {
+		return a.initErr
+	}
+	var err error
+	for _, hook := range a.OnStart {
+		if err = hook(ctx, a); err != nil {
+			return errs.Wrap(err, "Failed to run the start hook of app [{0}]", a.Name)
+		}
+	}
+	// the start hooks have run, so the stop hooks release what they acquired if no server can start
+	for _, svr := range a.Servers {
+		if err = svr.prepare(); err != nil {
+			return errors.Join(append([]error{err}, a.runStopHooks(ctx)...)...)
+		}
+	}
+	for i, svr := range a.Servers {
+		if err = svr.listen(); err != nil {
+			// release the servers already listening
+			for _, listening := range a.Servers[:i] {
+				_ = listening.shutdown(ctx)
+			}
+			return errors.Join(append([]error{err}, a.runStopHooks(ctx)...)...)
+		}
+	}
+
+	a.started = true
+	a.serveErrs = make(chan error, len(a.Servers))
+	for _, svr := range a.Servers {
+		a.serving.Add(1)
+		go func() {
+			defer a.serving.Done()
+			if err := svr.serve(); err != nil {
+				a.serveErrs <- errs.Wrap(err, "Server [{0}] failed", svr.Name)
+			}
+		}()
+	}
+	a.ready.Store(true)
+
+	for _, hook := range a.OnReady {
+		if err = hook(ctx, a); err != nil {
+			err = errs.Wrap(err, "Failed to run the ready hook of app [{0}]", a.Name)
+			return errors.Join(err, a.stop(ctx))
+		}
+	}
+	return nil
+}
+
+// Stop shuts down all servers in parallel, waits for them to drain within their ShutdownTimeout,
+// and then runs the OnStop hooks
+func (a *App[C]) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.started {
+		return errs.New("App [{0}] is not started", a.Name)
+	}
+	return a.stop(ctx)
+}
+
+func (a *App[C]) stop(ctx context.Context) error {
+	a.ready.Store(false)
+
+	var mu sync.Mutex
+	var errList []error
+	var wg sync.WaitGroup
+	for _, svr := range a.Servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := svr.shutdown(ctx); err != nil {
+				mu.Lock()
+				errList = append(errList, errs.Wrap(err, "Failed to shutdown server [{0}] gracefully", svr.Name))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	a.serving.Wait()
+	a.started = false
+
+	errList = append(errList, a.runStopHooks(ctx)...)
+	return errors.Join(errList...)
+}
+
+// runStopHooks runs every stop hook, even if the preceding ones failed
+func (a *App[C]) runStopHooks(ctx context.Context) []error {
+	var errList []error
+	for _, hook := range a.OnStop {
+		if err := hook(ctx, a); err != nil {
+			errList = append(errList, errs.Wrap(err, "Failed to run the stop hook of app [{0}]", a.Name))
+		}
+	}
+	return errList
 }
 
-func (a *App[C]) init() {
+func (a *App[C]) init() error {
 	var err error
 	a.Name, err = def.GetStr("app.Name", a.Name)
 	if err != nil && !cfg.IsCfgMissingErr(err) {
-		panic(err)
+		return err
 	}
 	if a.Name == "" {
 		processPath := os.Args[0]
 		a.Name = filepath.Base(processPath)
 	}
 
+	for _, bundle := range a.MessageBundles {
+		if err = AddMessageBundle(bundle); err != nil {
+			return errs.Wrap(err, "Failed to load the message bundles of app [{0}]", a.Name)
+		}
+	}
+
 	t := reflect.TypeOf(a.Context)
 	if t.Kind() != reflect.Pointer {
-		panic("The app Context should be pointer kind")
+		return errs.New("The app Context should be pointer kind")
 	}
 
 	if reflect.ValueOf(a.Context).IsNil() {
 		appCtx := reflect.New(t.Elem()).Interface()
 		a.Context = appCtx.(C)
 	}
-	initAppContextAttribute(a)
+	err = initAppContextAttribute(a)
+	if err != nil {
+		return err
+	}
 
 	svrCfgs, err := def.GetObj[[]svrCfg]("app.servers")
 	if err != nil && !cfg.IsCfgMissingErr(err) {
-		panic(err)
+		return err
 	}
 	for _, scfg := range svrCfgs {
 		if scfg.Name == "" {
-			log.Panic("Server name must not be empty! Please check the configuration files.")
+			return errs.New("Server name must not be empty! Please check the configuration files.")
 		}
 		var svrCreated bool
 		for _, svr := range a.Servers {
@@ -94,12 +255,36 @@ func (a *App[C]) init() {
 				if scfg.KeyFile != "" {
 					svr.KeyFile = scfg.KeyFile
 				}
+				if scfg.TLSMode != "" {
+					svr.TLSMode = scfg.TLSMode
+				}
 				if scfg.Debug != nil {
 					svr.Debug = *scfg.Debug
 				}
 				if scfg.ShutdownTimeout > 0 {
 					svr.ShutdownTimeout = time.Millisecond * time.Duration(scfg.ShutdownTimeout)
 				}
+				if scfg.OpenAPIPath != "" {
+					svr.OpenAPIPath = scfg.OpenAPIPath
+				}
+				if scfg.DocsPath != "" {
+					svr.DocsPath = scfg.DocsPath
+				}
+				if scfg.DebugRoutesPath != "" {
+					svr.DebugRoutesPath = scfg.DebugRoutesPath
+				}
+				if scfg.APIVersion != "" {
+					svr.APIVersion = scfg.APIVersion
+				}
+				if scfg.MaxUploadFileBytes > 0 {
+					svr.MaxUploadFileBytes = scfg.MaxUploadFileBytes
+				}
+				if scfg.MaxUploadBytes > 0 {
+					svr.MaxUploadBytes = scfg.MaxUploadBytes
+				}
+				if scfg.DefaultLocale != "" {
+					svr.Locale.Default = scfg.DefaultLocale
+				}
 				break
 			}
 		}
@@ -108,12 +293,20 @@ func (a *App[C]) init() {
 			svr.Port = scfg.Port
 			svr.CertFile = scfg.CertFile
 			svr.KeyFile = scfg.KeyFile
+			svr.TLSMode = scfg.TLSMode
 			if scfg.ShutdownTimeout > 0 {
 				svr.ShutdownTimeout = time.Millisecond * time.Duration(scfg.ShutdownTimeout)
 			}
 			if scfg.Debug != nil {
 				svr.Debug = *scfg.Debug
 			}
+			svr.OpenAPIPath = scfg.OpenAPIPath
+			svr.DocsPath = scfg.DocsPath
+			svr.DebugRoutesPath = scfg.DebugRoutesPath
+			svr.APIVersion = scfg.APIVersion
+			svr.MaxUploadFileBytes = scfg.MaxUploadFileBytes
+			svr.MaxUploadBytes = scfg.MaxUploadBytes
+			svr.Locale.Default = scfg.DefaultLocale
 			a.Servers = append(a.Servers, svr)
 		}
 	}
@@ -121,7 +314,7 @@ func (a *App[C]) init() {
 	svrNames := make(map[string]struct{})
 	for _, svr := range a.Servers {
 		if _, ok := svrNames[svr.Name]; ok {
-			log.Panic("Duplicate server name: [{0}]", svr.Name)
+			return errs.New("Duplicate server name: [{0}]", svr.Name)
 		}
 		svrNames[svr.Name] = struct{}{}
 
@@ -136,48 +329,80 @@ func (a *App[C]) init() {
 	for _, initializer := range a.Initializers {
 		err = initializer(a)
 		if err != nil {
-			panic(err)
+			return err
 		}
 	}
+	return nil
 }
 
 type AppInitializer[C any] func(app *App[C]) error
 
 func Mount[C any, I any, O any](e *Endpoint[I, O], a *App[C], svrName ...string) {
+	mount(a, "endpoint", e.Name, e, svrName...)
+}
+
+// MountSSE mounts the Server-Sent Events endpoint to the server
+func MountSSE[C any, I any, E any](e *SSEEndpoint[I, E], a *App[C], svrName ...string) {
+	mount(a, "endpoint", e.Name, e, svrName...)
+}
+
+// MountWebSocket mounts the WebSocket endpoint to the server
+func MountWebSocket[C any, I any, M any](e *WebSocketEndpoint[I, M], a *App[C], svrName ...string) {
+	mount(a, "endpoint", e.Name, e, svrName...)
+}
+
+func mount[C any](a *App[C], kind, name string, m Mountable, svrName ...string) {
 	a.Initializers = append(a.Initializers, func(app *App[C]) error {
-		if len(svrName) == 0 {
-			if len(app.Servers) == 0 {
-				app.Servers = append(app.Servers, newDefaultServer(app.Name+"_server"))
-			}
-			e.appendToServer(app.Servers[0], app.DecryptFns)
-		} else {
-			var mounted bool
-			for _, svr := range app.Servers {
-				if svr.Name == svrName[0] {
-					e.appendToServer(svr, app.DecryptFns)
-					mounted = true
-					break
-				}
-			}
-			if !mounted {
-				log.Panic("Failed to mount endpoint [{0}] to server [{1}]: server not defined", e.Name, svrName[0])
-			}
+		svr := app.lookupServer(svrName...)
+		if svr == nil {
+			return errs.New("Failed to mount {0} [{1}] to server [{2}]: server not defined", kind, name, svrName[0])
 		}
-		return nil
+		return m.appendToServer(svr, app.DecryptFns, nil)
 	})
 }
 
-func initAppContextAttribute[C any](a *App[C]) {
+// MountGroup mounts the group, including all of its endpoints and nested groups, to the server
+func MountGroup[C any](g *Group, a *App[C], svrName ...string) {
+	a.Initializers = append(a.Initializers, func(app *App[C]) error {
+		if g.parent != nil {
+			return errs.New("Failed to mount group [{0}]: only the outermost group can be mounted to a server", g.Prefix)
+		}
+		svr := app.lookupServer(svrName...)
+		if svr == nil {
+			return errs.New("Failed to mount group [{0}] to server [{1}]: server not defined", g.Prefix, svrName[0])
+		}
+		return g.mountTo(svr, app.DecryptFns)
+	})
+}
+
+// lookupServer finds the server with the given name, the first server is returned (and created if absent)
+// when no name is given
+func (a *App[C]) lookupServer(svrName ...string) *Server {
+	if len(svrName) == 0 {
+		if len(a.Servers) == 0 {
+			a.Servers = append(a.Servers, newDefaultServer(a.Name+"_server"))
+		}
+		return a.Servers[0]
+	}
+	for _, svr := range a.Servers {
+		if svr.Name == svrName[0] {
+			return svr
+		}
+	}
+	return nil
+}
+
+func initAppContextAttribute[C any](a *App[C]) error {
 	t := reflect.TypeOf(a.Context)
 	v := reflect.ValueOf(a.Context)
 	for v.Kind() == reflect.Pointer {
 		t = t.Elem()
 		v = v.Elem()
 	}
-	populateObject(v, t, "")
+	return populateObject(v, t, "")
 }
 
-func populateObject(val reflect.Value, typ reflect.Type, keyPrefix string) {
+func populateObject(val reflect.Value, typ reflect.Type, keyPrefix string) error {
 	for i := 0; i < typ.NumField(); i++ {
 		f := typ.Field(i)
 		fv := val.Field(i)
@@ -192,22 +417,26 @@ func populateObject(val reflect.Value, typ reflect.Type, keyPrefix string) {
 		if defStrValue, ok := f.Tag.Lookup("default"); ok {
 			err := rflt.UnmarshalValue(fv, defStrValue)
 			if err != nil {
-				panic(err)
+				return errs.Wrap(err, "Cannot resolve the default value of [{0}]", f.Name)
 			}
 		}
 		if cfgKey == "" {
 			continue
 		}
 		if ft.Kind() == reflect.Struct {
-			populateObject(fv, ft, keyPrefix+cfgKey+".")
+			err := populateObject(fv, ft, keyPrefix+cfgKey+".")
+			if err != nil {
+				return err
+			}
 		} else {
 			envValue, _ := def.GetStr(keyPrefix + cfgKey)
 			if len(envValue) > 0 {
 				err := rflt.UnmarshalValue(fv, envValue)
 				if err != nil {
-					panic(errs.Wrap(err, "Cannot resolve configuration item [{0}]", cfgKey))
+					return errs.Wrap(err, "Cannot resolve configuration item [{0}]", cfgKey)
 				}
 			}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,327 @@
+package sprout
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type appTestContext struct{}
+
+type appTestInput struct {
+	Name string `query:"name"`
+}
+
+func freePort(t *testing.T) uint16 {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestAppRestart(t *testing.T) {
+	svr := newDefaultServer("test")
+	svr.Port = freePort(t)
+	var stops int
+	app := &App[*appTestContext]{
+		Name:    "test",
+		Servers: []*Server{svr},
+		OnStop: []AppHook[*appTestContext]{func(ctx context.Context, app *App[*appTestContext]) error {
+			stops++
+			return nil
+		}},
+	}
+	Mount(&Endpoint[appTestInput, string]{
+		Name:    "hello",
+		Pattern: "/hello",
+		Methods: []string{http.MethodGet},
+		Handler: func(ctx *Context, in appTestInput) (string, error) { return "hello " + in.Name, nil },
+	}, app)
+
+	for i := 0; i < 2; i++ {
+		if err := app.Start(context.Background()); err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+		if !app.Ready() {
+			t.Errorf("start %d: expected the app to be ready", i)
+		}
+		resp, err := http.Get("http://127.0.0.1:" + strconv.Itoa(int(svr.Port)) + "/hello?name=sprout")
+		if err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("start %d: expected 200, got %d", i, resp.StatusCode)
+		}
+		if err = app.Stop(context.Background()); err != nil {
+			t.Fatalf("stop %d: %v", i, err)
+		}
+	}
+	if len(svr.endpoints) != 1 {
+		t.Errorf("expected the endpoint to be mounted once, got %d", len(svr.endpoints))
+	}
+	if stops != 2 {
+		t.Errorf("expected the stop hooks to run on every stop, got %d", stops)
+	}
+	if err := app.Stop(context.Background()); err == nil {
+		t.Error("expected stopping a stopped app to fail")
+	}
+}
+
+func TestAppStartFailed(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	svr := newDefaultServer("test")
+	svr.Port = uint16(busy.Addr().(*net.TCPAddr).Port)
+	var starts, stops int
+	app := &App[*appTestContext]{
+		Name:    "test",
+		Servers: []*Server{svr},
+		OnStart: []AppHook[*appTestContext]{func(ctx context.Context, app *App[*appTestContext]) error {
+			starts++
+			return nil
+		}},
+		OnStop: []AppHook[*appTestContext]{func(ctx context.Context, app *App[*appTestContext]) error {
+			stops++
+			return nil
+		}},
+	}
+	if err = app.Start(context.Background()); err == nil {
+		t.Fatal("expected starting on a busy port to fail")
+	}
+	if starts != 1 || stops != 1 {
+		t.Errorf("expected the stop hooks to release the start hooks, got %d starts and %d stops", starts, stops)
+	}
+	if app.Ready() {
+		t.Error("expected the app not to be ready")
+	}
+}
+
+// newDrainTestApp returns an app whose servers serve GET /slow with the handler
+func newDrainTestApp(t *testing.T, n int, handler func(ctx *Context, in appTestInput) (string, error)) *App[*appTestContext] {
+	t.Helper()
+	app := &App[*appTestContext]{Name: "test"}
+	for i := 0; i < n; i++ {
+		svr := newDefaultServer("test" + strconv.Itoa(i))
+		svr.Port = freePort(t)
+		app.Servers = append(app.Servers, svr)
+		Mount(&Endpoint[appTestInput, string]{
+			Name:    "slow",
+			Pattern: "/slow",
+			Methods: []string{http.MethodGet},
+			Handler: handler,
+		}, app, svr.Name)
+	}
+	return app
+}
+
+// getAsync sends GET /slow to the server, the result is sent to the channel once the response is received
+func getAsync(svr *Server) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://127.0.0.1:" + strconv.Itoa(int(svr.Port)) + "/slow")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = errors.New(resp.Status)
+			}
+		}
+		result <- err
+	}()
+	return result
+}
+
+func TestAppStopDrainsInParallel(t *testing.T) {
+	// every server is draining its request, which is not finished until all servers are shutting down,
+	// so that the servers drained one by one would never stop
+	var shuttingDown sync.WaitGroup
+	shuttingDown.Add(2)
+	allShuttingDown := make(chan struct{})
+	go func() {
+		shuttingDown.Wait()
+		close(allShuttingDown)
+	}()
+	entered := make(chan struct{}, 2)
+	var app *App[*appTestContext]
+	var readyWhileDraining []bool
+	var mu sync.Mutex
+	app = newDrainTestApp(t, 2, func(ctx *Context, in appTestInput) (string, error) {
+		entered <- struct{}{}
+		select {
+		case <-allShuttingDown:
+		case <-time.After(5 * time.Second):
+			return "", errors.New("the servers are not shut down in parallel")
+		}
+		mu.Lock()
+		readyWhileDraining = append(readyWhileDraining, app.Ready())
+		mu.Unlock()
+		return "ok", nil
+	})
+	app.OnReady = []AppHook[*appTestContext]{func(ctx context.Context, app *App[*appTestContext]) error {
+		for _, svr := range app.Servers {
+			svr.httpServer.RegisterOnShutdown(shuttingDown.Done)
+		}
+		return nil
+	}}
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	results := []<-chan error{getAsync(app.Servers[0]), getAsync(app.Servers[1])}
+	<-entered
+	<-entered
+
+	begin := time.Now()
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed > 3*time.Second {
+		t.Errorf("expected the servers to drain in parallel, took %s", elapsed)
+	}
+	for i, result := range results {
+		if err := <-result; err != nil {
+			t.Errorf("server %d: expected the in-flight request to be served, got %v", i, err)
+		}
+	}
+	if !slices.Equal(readyWhileDraining, []bool{false, false}) {
+		t.Errorf("expected the app not to be ready while draining, got %v", readyWhileDraining)
+	}
+}
+
+func TestAppHooksOrder(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	hook := func(name string) AppHook[*appTestContext] {
+		return func(ctx context.Context, app *App[*appTestContext]) error {
+			record(name + " ready=" + strconv.FormatBool(app.Ready()))
+			return nil
+		}
+	}
+	release := make(chan struct{})
+	app := newDrainTestApp(t, 1, func(ctx *Context, in appTestInput) (string, error) {
+		record("request")
+		<-release
+		record("response")
+		return "ok", nil
+	})
+	app.OnStart = []AppHook[*appTestContext]{hook("start1"), hook("start2")}
+	app.OnReady = []AppHook[*appTestContext]{hook("ready1"), hook("ready2")}
+	app.OnStop = []AppHook[*appTestContext]{hook("stop1"), hook("stop2")}
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	result := getAsync(app.Servers[0])
+	for {
+		mu.Lock()
+		n := len(events)
+		mu.Unlock()
+		if n == 5 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.AfterFunc(100*time.Millisecond, func() { close(release) })
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	// the stop hooks run after the servers have been drained
+	expected := []string{"start1 ready=false", "start2 ready=false", "ready1 ready=true", "ready2 ready=true",
+		"request", "response", "stop1 ready=false", "stop2 ready=false"}
+	if !slices.Equal(events, expected) {
+		t.Errorf("expected the events %v, got %v", expected, events)
+	}
+}
+
+func TestAppStopTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	entered := make(chan struct{})
+	app := newDrainTestApp(t, 1, func(ctx *Context, in appTestInput) (string, error) {
+		close(entered)
+		<-release
+		return "ok", nil
+	})
+	app.Servers[0].ShutdownTimeout = 100 * time.Millisecond
+	var stopped bool
+	app.OnStop = []AppHook[*appTestContext]{func(ctx context.Context, app *App[*appTestContext]) error {
+		stopped = true
+		return nil
+	}}
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	getAsync(app.Servers[0])
+	<-entered
+
+	begin := time.Now()
+	err := app.Stop(context.Background())
+	if elapsed := time.Since(begin); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected the server to be drained within its shutdown timeout, took %s", elapsed)
+	}
+	// errs.Err.Is does not match the causes, look for the timeout error in the chain
+	var timeout interface{ Timeout() bool }
+	if !errors.As(err, &timeout) || !timeout.Timeout() {
+		t.Errorf("expected the shutdown to time out, got %v", err)
+	}
+	if !stopped {
+		t.Error("expected the stop hooks to run although the server has not been drained")
+	}
+}
+
+func TestAppRunStopsOnSignal(t *testing.T) {
+	app := newDrainTestApp(t, 1, func(ctx *Context, in appTestInput) (string, error) { return "ok", nil })
+	stopped := make(chan struct{})
+	app.OnStop = []AppHook[*appTestContext]{func(ctx context.Context, app *App[*appTestContext]) error {
+		close(stopped)
+		return nil
+	}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.Run()
+	}()
+	for !app.Ready() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := <-getAsync(app.Servers[0]); err != nil {
+		t.Fatal(err)
+	}
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Signal(syscall.SIGTERM); err != nil {
+		t.Skip("the signals are not supported: ", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the app to stop on SIGTERM")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("expected the stop hooks to run")
+	}
+}
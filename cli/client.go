@@ -37,7 +37,37 @@ func NewH3Client(timeout time.Duration) *Client {
 }
 
 func NewH3ClientWithTLS(timeout time.Duration, insecureSkipVerify bool) *Client {
-	roundTripper := &http3.Transport{
+	client := http.Client{
+		Transport: newH3Transport(insecureSkipVerify),
+		Timeout:   timeout,
+	}
+	return &Client{Client: client}
+}
+
+// NewTLSClient creates a client speaking HTTP/1.1 or HTTP/2 over TLS
+func NewTLSClient(timeout time.Duration, insecureSkipVerify bool) *Client {
+	client := http.Client{
+		Transport: newTLSTransport(insecureSkipVerify),
+		Timeout:   timeout,
+	}
+	return &Client{Client: client}
+}
+
+// NewAltSvcClient creates a client which connects through TCP at first, and switches to HTTP/3 once
+// the server advertises it on the same port through the Alt-Svc header
+func NewAltSvcClient(timeout time.Duration, insecureSkipVerify bool) *Client {
+	client := http.Client{
+		Transport: &altSvcTransport{
+			tcp: newTLSTransport(insecureSkipVerify),
+			h3:  newH3Transport(insecureSkipVerify),
+		},
+		Timeout: timeout,
+	}
+	return &Client{Client: client}
+}
+
+func newH3Transport(insecureSkipVerify bool) *http3.Transport {
+	return &http3.Transport{
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: insecureSkipVerify,
 		},
@@ -47,11 +77,15 @@ func NewH3ClientWithTLS(timeout time.Duration, insecureSkipVerify bool) *Client
 			EnableDatagrams: true,
 		},
 	}
-	client := http.Client{
-		Transport: roundTripper,
-		Timeout:   timeout,
+}
+
+func newTLSTransport(insecureSkipVerify bool) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
 	}
-	return &Client{Client: client}
+	transport.ForceAttemptHTTP2 = true
+	return transport
 }
 
 func NewH2cClient(timeout time.Duration) *Client {
@@ -84,12 +118,7 @@ func Doer[T, R any](client *Client, method, url, contentType string) func(ctx co
 }
 
 func (c *Client) Do(ctx context.Context, method, url, contentType string, in, out any) error {
-	url, body, err := makeUrlAndBody(url, contentType, in)
-	if err != nil {
-		return err
-	}
-
-	r, err := http.NewRequestWithContext(ctx, method, url, body)
+	r, err := newRequest(ctx, method, url, contentType, in)
 	if err != nil {
 		return err
 	}
@@ -97,6 +126,7 @@ func (c *Client) Do(ctx context.Context, method, url, contentType string, in, ou
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	if out != nil {
 		err = resolveHttpResponse(resp, out)
@@ -108,14 +138,44 @@ func (c *Client) Do(ctx context.Context, method, url, contentType string, in, ou
 	return nil
 }
 
-func makeUrlAndBody(url, contentType string, in any) (string, io.Reader, error) {
-	serializer := serializers[contentType]
-	if serializer == nil {
-		return "", nil, errs.New("Serializer not found for content type: {0}", contentType)
+// newRequest makes the request from the input model, the fields are bound to the path parameters,
+// queries, headers and cookies according to their tags, the rest fields go to the body
+func newRequest(ctx context.Context, method, url, contentType string, in any) (*http.Request, error) {
+	url, body, header, cookies, err := makeUrlAndBody(url, contentType, in)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	for i := range cookies {
+		r.AddCookie(&cookies[i])
+	}
+	return r, nil
+}
+
+func makeUrlAndBody(url, contentType string, in any) (string, io.Reader, map[string]string, []http.Cookie, error) {
+	// no body is sent if the content type is empty
+	var serializer Serializer
+	if contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			serializer = lookupSerializer(mediaType)
+		}
+	}
+	if serializer == nil && contentType != "" {
+		return "", nil, nil, nil, errs.New("Serializer not found for content type: {0}", contentType)
 	}
 	v := reflect.ValueOf(in).Elem()
 	t := reflect.TypeOf(in).Elem()
 	header := make(map[string]string)
+	pathParams := make(map[string]string)
 	var cookies []http.Cookie
 	var bodyKeys []string
 	for i := 0; i < t.NumField(); i++ {
@@ -124,13 +184,13 @@ func makeUrlAndBody(url, contentType string, in any) (string, io.Reader, error)
 		if pname, ok := f.Tag.Lookup("path"); ok {
 			valStr, err := rflt.ValueToString(fv)
 			if err != nil {
-				return "", nil, err
+				return "", nil, nil, nil, err
 			}
-			url = strings.Replace(url, "{"+pname+"}", valStr, 1)
+			pathParams[pname] = valStr
 		} else if pname, ok := f.Tag.Lookup("query"); ok {
 			valStr, err := rflt.ValueToString(fv)
 			if err != nil {
-				return "", nil, err
+				return "", nil, nil, nil, err
 			}
 			if valStr != "" {
 				if strings.Contains(url, "?") {
@@ -142,7 +202,7 @@ func makeUrlAndBody(url, contentType string, in any) (string, io.Reader, error)
 		} else if pname, ok := f.Tag.Lookup("header"); ok {
 			valStr, err := rflt.ValueToString(fv)
 			if err != nil {
-				return "", nil, err
+				return "", nil, nil, nil, err
 			}
 			if valStr != "" {
 				header[pname] = valStr
@@ -150,7 +210,7 @@ func makeUrlAndBody(url, contentType string, in any) (string, io.Reader, error)
 		} else if pname, ok := f.Tag.Lookup("cookie"); ok {
 			valStr, err := rflt.ValueToString(fv)
 			if err != nil {
-				return "", nil, err
+				return "", nil, nil, nil, err
 			}
 			if valStr != "" {
 				cookies = append(cookies, http.Cookie{
@@ -162,15 +222,39 @@ func makeUrlAndBody(url, contentType string, in any) (string, io.Reader, error)
 			bodyKeys = append(bodyKeys, f.Name)
 		}
 	}
+	url, err := expandUrl(url, pathParams)
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
 	var body io.Reader
-	var err error
-	if in != nil {
+	if in != nil && serializer != nil {
 		body, err = serializer(in, bodyKeys)
 		if err != nil {
-			return "", nil, err
+			return "", nil, nil, nil, err
+		}
+	}
+	return url, body, header, cookies, nil
+}
+
+// expandUrl fills the path parameters into the path of the url, which follows the uri pattern syntax of the server
+func expandUrl(url string, params map[string]string) (string, error) {
+	pathStart := 0
+	if i := strings.Index(url, "://"); i >= 0 {
+		if j := strings.IndexByte(url[i+3:], '/'); j >= 0 {
+			pathStart = i + 3 + j
+		} else {
+			return url, nil
 		}
 	}
-	return url, body, nil
+	pathEnd := len(url)
+	if i := strings.IndexAny(url[pathStart:], "?#"); i >= 0 {
+		pathEnd = pathStart + i
+	}
+	path, err := sp.ExpandPattern(url[pathStart:pathEnd], params)
+	if err != nil {
+		return "", err
+	}
+	return url[:pathStart] + path + url[pathEnd:], nil
 }
 
 func resolveHttpResponse(resp *http.Response, out any) error {
@@ -181,7 +265,7 @@ func resolveHttpResponse(resp *http.Response, out any) error {
 	if respContentType == "*/*" {
 		respContentType = sp.MimeJson
 	}
-	deserializer := deserializers[respContentType]
+	deserializer := lookupDeserializer(respContentType)
 	if deserializer == nil {
 		return errs.New("No deserializer found for content type: {0}", respContentType)
 	}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"encoding"
+	"io"
+	urlpkg "net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/rflt"
+)
+
+// SerializeUrlencodedForm encodes the body fields of the model as an application/x-www-form-urlencoded body,
+// with the same naming as the server side: the form tag or the field name, address.city for the fields of
+// nested structs, repeated keys for slices of scalars, items[0].sku for slices of structs and attrs[color] for maps.
+func SerializeUrlencodedForm(model any, bodyKeys []string) (io.Reader, error) {
+	v := reflect.ValueOf(model)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errs.New("The form model must be a struct, but got [{0}]", v.Type())
+	}
+	values := make(urlpkg.Values)
+	for _, key := range bodyKeys {
+		f, ok := v.Type().FieldByName(key)
+		if !ok || !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("form"); ok && tag != "" {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		err := encodeFormValue(values, name, v.FieldByIndex(f.Index))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return strings.NewReader(values.Encode()), nil
+}
+
+func encodeFormValue(values urlpkg.Values, name string, fv reflect.Value) error {
+	for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	if m, ok := fv.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return err
+		}
+		values.Add(name, string(text))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		for i := 0; i < fv.NumField(); i++ {
+			f := fv.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			sub := f.Name
+			if tag, ok := f.Tag.Lookup("form"); ok && tag != "" {
+				if tag == "-" {
+					continue
+				}
+				sub = tag
+			}
+			if err := encodeFormValue(values, name+"."+sub, fv.Field(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8 {
+			values.Add(name, string(fv.Bytes()))
+			return nil
+		}
+		for i := 0; i < fv.Len(); i++ {
+			elemName := name
+			if !isFormScalar(fv.Type().Elem()) {
+				elemName = name + "[" + strconv.Itoa(i) + "]"
+			}
+			if err := encodeFormValue(values, elemName, fv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		iter := fv.MapRange()
+		for iter.Next() {
+			key, err := rflt.ValueToString(iter.Key())
+			if err != nil {
+				return err
+			}
+			if err = encodeFormValue(values, name+"["+key+"]", iter.Value()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.String:
+		values.Add(name, fv.String())
+		return nil
+	case reflect.Float32, reflect.Float64:
+		values.Add(name, strconv.FormatFloat(fv.Float(), 'f', -1, fv.Type().Bits()))
+		return nil
+	}
+	str, err := rflt.ValueToString(fv)
+	if err != nil {
+		return err
+	}
+	values.Add(name, str)
+	return nil
+}
+
+// isFormScalar reports whether the values of the type are encoded as a single form value
+func isFormScalar(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Implements(reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Array, reflect.Interface:
+		return false
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return true
+}
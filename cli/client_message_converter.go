@@ -7,11 +7,13 @@ import (
 	"io"
 
 	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/log"
+	sp "github.com/wxy365/sprout"
 )
 
 var (
-	serializers   map[string]Serializer
-	deserializers map[string]Deserializer
+	serializers   sp.MediaTypeRegistry[Serializer]
+	deserializers sp.MediaTypeRegistry[Deserializer]
 )
 
 type Serializer func(model any, bodyKeys []string) (io.Reader, error)
@@ -62,6 +64,15 @@ func map2Err(m map[string]any, err *errs.Err) {
 			err.Message = fmt.Sprint(msg)
 		}
 	}
+	// problem details (RFC 9457), the detail is preferred to the title
+	if err.Message == "" {
+		for _, key := range []string{"detail", "title"} {
+			if s, ok := m[key].(string); ok && s != "" {
+				err.Message = s
+				break
+			}
+		}
+	}
 	if status, exists := m["status"]; exists {
 		if f, ok := status.(float64); ok {
 			err.Status = int(f)
@@ -78,9 +89,36 @@ func map2Err(m map[string]any, err *errs.Err) {
 	}
 }
 
+// RegisterSerializer registers the serializer of the request body of the media type, eg. application/xml
+// or a vendor type like application/vnd.acme+json. It panics if the media type is invalid.
+func RegisterSerializer(contentType string, serializer Serializer) {
+	if err := serializers.Register(contentType, serializer); err != nil {
+		log.PanicErr(err)
+	}
+}
+
+// RegisterDeserializer registers the deserializer of the response body of the media type, it panics if the media type is invalid
+func RegisterDeserializer(contentType string, deserializer Deserializer) {
+	if err := deserializers.Register(contentType, deserializer); err != nil {
+		log.PanicErr(err)
+	}
+}
+
+// lookupSerializer looks up the serializer of the media type, falling back to the one of the
+// structured syntax suffix, eg. application/json for application/vnd.acme+json
+func lookupSerializer(mediaType string) Serializer {
+	s, _ := serializers.Lookup(mediaType)
+	return s
+}
+
+// lookupDeserializer looks up the deserializer of the media type, falling back to the one of the structured syntax suffix
+func lookupDeserializer(mediaType string) Deserializer {
+	d, _ := deserializers.Lookup(mediaType)
+	return d
+}
+
 func init() {
-	serializers = make(map[string]Serializer)
-	deserializers = make(map[string]Deserializer)
-	serializers["application/json"] = SerializeJson
-	deserializers["application/json"] = DeserializeJson
+	RegisterSerializer(sp.MimeJson, SerializeJson)
+	RegisterDeserializer(sp.MimeJson, DeserializeJson)
+	RegisterSerializer(sp.MimeUrlencodedForm, SerializeUrlencodedForm)
 }
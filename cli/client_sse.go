@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/wxy365/basal/errs"
+	sp "github.com/wxy365/sprout"
+)
+
+// Event is a Server-Sent Event received from the server
+type Event[E any] struct {
+	Id   string
+	Name string
+	Data E
+	// set if the data cannot be decoded, the server sends an "error" event, or the stream breaks
+	Err error
+}
+
+// SSEDoer creates a function subscribing to a Server-Sent Events endpoint. The events are delivered through
+// the returned channel, which is closed once the stream ends or the context is canceled.
+// The timeout of the client does not apply to the stream. To resume a stream, carry the id of the last
+// received event in an input field tagged with `header:"Last-Event-ID"`.
+func SSEDoer[T, E any](client *Client, url string) func(ctx context.Context, in *T) (<-chan Event[E], error) {
+	var t T
+	if reflect.TypeOf(t).Kind() != reflect.Struct {
+		panic("The input type should be of struct kind")
+	}
+	httpClient := client.Client
+	httpClient.Timeout = 0
+	return func(ctx context.Context, in *T) (<-chan Event[E], error) {
+		r, err := newRequest(ctx, http.MethodGet, url, "", in)
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Accept", sp.MimeEventStream)
+		resp, err := httpClient.Do(r)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			err = resolveHttpResponse(resp, new(struct{}))
+			if err == nil {
+				err = errs.New("Unexpected status of the event stream: {0}", resp.StatusCode).WithStatus(resp.StatusCode)
+			}
+			return nil, err
+		}
+
+		events := make(chan Event[E])
+		go func() {
+			defer close(events)
+			defer resp.Body.Close()
+			readEvents(ctx, resp.Body, events)
+		}()
+		return events, nil
+	}
+}
+
+func readEvents[E any](ctx context.Context, body io.Reader, events chan<- Event[E]) {
+	reader := bufio.NewReader(body)
+	var ev Event[E]
+	var data []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				select {
+				case events <- Event[E]{Err: err}:
+				case <-ctx.Done():
+				}
+			}
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			// a blank line dispatches the event
+			if len(data) > 0 {
+				decodeEventData(&ev, strings.Join(data, "\n"))
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+			ev = Event[E]{}
+			data = nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comments, eg. heartbeats
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			ev.Id = value
+		case "event":
+			ev.Name = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+}
+
+func decodeEventData[E any](ev *Event[E], data string) {
+	if ev.Name == "error" {
+		ev.Err = errs.New("{0}", data)
+		return
+	}
+	if p, ok := any(&ev.Data).(*string); ok {
+		*p = data
+		return
+	}
+	ev.Err = lookupDeserializer(sp.MimeJson)(strings.NewReader(data), nil, &ev.Data)
+}
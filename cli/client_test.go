@@ -2,10 +2,19 @@ package cli
 
 import (
 	"context"
+	"errors"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/quic-go/quic-go/http3"
+	"github.com/wxy365/basal/errs"
 	sp "github.com/wxy365/sprout"
 )
 
@@ -38,3 +47,130 @@ type DemoOut struct {
 type DemoAppCtx struct {
 	Ins []DemoIn `env:"DEMO_APP_INS" default:"[{\"id\":123, \"name\":\"xixi\"}]"`
 }
+
+func TestDecodeEventError(t *testing.T) {
+	var ev Event[DemoOut]
+	ev.Name = "error"
+	// the data sent by the server is not a format string
+	decodeEventData(&ev, "Topic [{0}] not found")
+	var leiErr *errs.Err
+	if !errors.As(ev.Err, &leiErr) || leiErr.Message != "Topic [{0}] not found" {
+		t.Errorf("expected the error event data verbatim, got %v", ev.Err)
+	}
+}
+
+type formTestItem struct {
+	Sku   string  `form:"sku"`
+	Price float64 `form:"price"`
+}
+
+type formTestModel struct {
+	Name    string                `form:"name"`
+	Tags    []string              `form:"tags"`
+	Address struct{ City string } `form:"address"`
+	Items   []formTestItem        `form:"items"`
+	Attrs   map[string]string     `form:"attrs"`
+	Skipped string                `form:"-"`
+}
+
+func TestUrlencodedFormRoundTrip(t *testing.T) {
+	in := formTestModel{
+		Name:    "a&b=c",
+		Tags:    []string{"x", "y"},
+		Items:   []formTestItem{{Sku: "a", Price: 1.5}, {Sku: "b"}},
+		Attrs:   map[string]string{"color": "red"},
+		Skipped: "skipped",
+	}
+	in.Address.City = "Paris"
+	body, err := SerializeUrlencodedForm(in, []string{"Name", "Tags", "Address", "Items", "Attrs", "Skipped"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out formTestModel
+	if err = sp.DeserializeUrlencodedForm(httptest.NewRequest(http.MethodPost, "/", body), &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Skipped = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("expected %+v, got %+v", in, out)
+	}
+}
+
+func TestAdvertisesH3(t *testing.T) {
+	for _, c := range []struct {
+		altSvc   []string
+		port     string
+		expected bool
+	}{
+		{[]string{`h3=":443"; ma=86400, h3-29=":443"; ma=86400`}, "443", true},
+		{[]string{`h3=":443"; ma=86400`}, "", true},
+		{[]string{`h3-29=":443"; ma=86400`}, "443", false},
+		{[]string{`h3=":8443"`}, "443", false},
+		{[]string{`h2=":443", h3=":443"`}, "443", true},
+		{[]string{`h2=":443"`, `h3=":443"`}, "443", true},
+		// the alternatives on other hosts are not followed
+		{[]string{`h3="alt.example.com:443"`}, "443", false},
+		{[]string{"clear"}, "443", false},
+		{nil, "443", false},
+	} {
+		if got := advertisesH3(c.altSvc, c.port); got != c.expected {
+			t.Errorf("%q on port %q: expected %t, got %t", c.altSvc, c.port, c.expected, got)
+		}
+	}
+}
+
+func TestAltSvcTransport(t *testing.T) {
+	var port string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Alt-Svc", `h3=":`+port+`"; ma=86400`)
+		w.Write([]byte(r.Proto + " " + string(body)))
+	})
+	tcpServer := httptest.NewUnstartedServer(handler)
+	tcpServer.EnableHTTP2 = true
+	tcpServer.StartTLS()
+	defer tcpServer.Close()
+	u, _ := url.Parse(tcpServer.URL)
+	port = u.Port()
+	// HTTP/3 is served on the same port through UDP
+	udpConn, err := net.ListenPacket("udp", u.Host)
+	if err != nil {
+		t.Skip("UDP is not available: ", err)
+	}
+	defer udpConn.Close()
+	h3Server := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(tcpServer.TLS.Clone())}
+	go h3Server.Serve(udpConn)
+
+	h3 := newH3Transport(true)
+	h3.QUICConfig.HandshakeIdleTimeout = time.Second
+	transport := &altSvcTransport{tcp: newTLSTransport(true), h3: h3}
+	defer h3.Close()
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+	post := func() string {
+		t.Helper()
+		resp, err := client.Post(tcpServer.URL, sp.MimeText, strings.NewReader("body"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if body := post(); body != "HTTP/2.0 body" {
+		t.Errorf("expected the first request over TCP, got %s", body)
+	}
+	if body := post(); body != "HTTP/3.0 body" {
+		t.Errorf("expected switching to HTTP/3 once advertised, got %s", body)
+	}
+	// HTTP/3 is blocked, the request is sent again through TCP with its body
+	h3Server.Close()
+	udpConn.Close()
+	h3.CloseIdleConnections()
+	if body := post(); body != "HTTP/2.0 body" {
+		t.Errorf("expected falling back to TCP, got %s", body)
+	}
+	if _, ok := transport.h3Hosts.Load(u.Host); !ok {
+		t.Error("expected the host advertising HTTP/3 again to be tried through HTTP/3 next time")
+	}
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// altSvcTransport sends requests through TCP, and switches to HTTP/3 for the hosts advertising
+// an "h3" alternative service on the same port
+type altSvcTransport struct {
+	tcp *http.Transport
+	h3  *http3.Transport
+
+	h3Hosts sync.Map // hosts known to support HTTP/3
+}
+
+func (t *altSvcTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Scheme == "https" {
+		if _, ok := t.h3Hosts.Load(r.URL.Host); ok {
+			resp, err := t.h3.RoundTrip(r)
+			if err == nil {
+				return resp, nil
+			}
+			// HTTP/3 may be blocked on the way, fall back to TCP
+			t.h3Hosts.Delete(r.URL.Host)
+			if r.Body != nil && r.Body != http.NoBody {
+				if r.GetBody == nil {
+					return nil, err
+				}
+				body, er := r.GetBody()
+				if er != nil {
+					return nil, err
+				}
+				r = r.Clone(r.Context())
+				r.Body = body
+			}
+		}
+	}
+	resp, err := t.tcp.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.URL.Scheme == "https" && advertisesH3(resp.Header.Values("Alt-Svc"), r.URL.Port()) {
+		t.h3Hosts.Store(r.URL.Host, struct{}{})
+	}
+	return resp, nil
+}
+
+// advertisesH3 reports whether the Alt-Svc header values contain an "h3" alternative on the given port,
+// eg. h3=":443"; ma=2592000
+func advertisesH3(altSvc []string, port string) bool {
+	if port == "" {
+		port = "443"
+	}
+	for _, value := range altSvc {
+		for _, alt := range strings.Split(value, ",") {
+			alt, _, _ = strings.Cut(alt, ";")
+			proto, authority, ok := strings.Cut(strings.TrimSpace(alt), "=")
+			if !ok || proto != "h3" {
+				continue
+			}
+			host, altPort, err := net.SplitHostPort(strings.Trim(authority, `"`))
+			if err == nil && host == "" && altPort == port {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -28,6 +28,14 @@ func (c *Context) Value(key any) any {
 	return c.Request.Context().Value(key)
 }
 
+// Locale returns the locale negotiated for the request, eg. zh-CN, see LocaleConfig
+func (c *Context) Locale() string {
+	if locale, ok := c.Value(ctxKeyLocale).(string); ok {
+		return locale
+	}
+	return DefaultLocale
+}
+
 func (c *Context) ClientIP() string {
 	return tp.GetClientIp(c.Request)
 }
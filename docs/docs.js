@@ -0,0 +1,143 @@
+// Renders the OpenAPI document referenced by the data-spec attribute of #docs,
+// the page is self-contained and works under a Content-Security-Policy of 'self'.
+(function () {
+  'use strict';
+
+  var root = document.getElementById('docs');
+  var methods = ['get', 'put', 'post', 'delete', 'options', 'head', 'patch', 'trace'];
+
+  function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (key) {
+      node.setAttribute(key, attrs[key]);
+    });
+    (children || []).forEach(function (child) {
+      node.appendChild(typeof child === 'string' ? document.createTextNode(child) : child);
+    });
+    return node;
+  }
+
+  function resolve(doc, schema) {
+    var prefix = '#/components/schemas/';
+    if (schema && schema.$ref && schema.$ref.indexOf(prefix) === 0) {
+      return doc.components.schemas[schema.$ref.substring(prefix.length)] || {};
+    }
+    return schema || {};
+  }
+
+  var constraints = ['format', 'pattern', 'minimum', 'maximum', 'exclusiveMinimum', 'exclusiveMaximum',
+    'minLength', 'maxLength', 'minItems', 'maxItems', 'uniqueItems', 'enum'];
+
+  function describe(schema) {
+    var parts = [];
+    constraints.forEach(function (key) {
+      if (schema[key] !== undefined) {
+        parts.push(key + ': ' + JSON.stringify(schema[key]));
+      }
+    });
+    return parts.length ? ' (' + parts.join(', ') + ')' : '';
+  }
+
+  // outline prints the schema as an indented outline, the referenced components are expanded once per branch
+  function outline(doc, schema, indent, seen) {
+    var name = schema.$ref ? schema.$ref.split('/').pop() : '';
+    if (name && seen.indexOf(name) >= 0) {
+      return name;
+    }
+    var resolved = resolve(doc, schema);
+    var next = name ? seen.concat(name) : seen;
+    var pad = new Array(indent + 2).join('  ');
+    switch (resolved.type) {
+      case 'object':
+        if (resolved.additionalProperties) {
+          return 'map<string, ' + outline(doc, resolved.additionalProperties, indent, next) + '>';
+        }
+        var required = resolved.required || [];
+        var lines = Object.keys(resolved.properties || {}).sort().map(function (key) {
+          var mark = required.indexOf(key) >= 0 ? '*' : '';
+          return pad + key + mark + ': ' + outline(doc, resolved.properties[key], indent + 1, next);
+        });
+        return (name || 'object') + ' {\n' + lines.join('\n') + '\n' + pad.substring(2) + '}';
+      case 'array':
+        return 'array<' + outline(doc, resolved.items || {}, indent, next) + '>' + describe(resolved);
+      case undefined:
+        return 'any';
+      default:
+        return resolved.type + describe(resolved);
+    }
+  }
+
+  function content(doc, media) {
+    return Object.keys(media || {}).map(function (type) {
+      return el('div', {}, [
+        el('code', {}, [type]),
+        el('pre', {}, [outline(doc, media[type].schema || {}, 0, [])])
+      ]);
+    });
+  }
+
+  function parameters(doc, params) {
+    var rows = params.map(function (p) {
+      return el('tr', {}, [
+        el('td', {}, [el('code', {}, [p.name + (p.required ? '*' : '')])]),
+        el('td', {}, [p.in]),
+        el('td', {}, [outline(doc, p.schema || {}, 0, [])]),
+        el('td', {}, [p.description || ''])
+      ]);
+    });
+    var head = el('tr', {}, ['Name', 'In', 'Schema', 'Description'].map(function (title) {
+      return el('th', {}, [title]);
+    }));
+    return el('table', {}, [head].concat(rows));
+  }
+
+  function operation(doc, path, method, op) {
+    var body = [];
+    if (op.operationId) {
+      body.push(el('p', {}, [el('code', {}, [op.operationId])]));
+    }
+    if (op.parameters && op.parameters.length) {
+      body.push(el('h4', {}, ['Parameters']), parameters(doc, op.parameters));
+    }
+    if (op.requestBody) {
+      body.push(el('h4', {}, ['Request body' + (op.requestBody.required ? '*' : '')]));
+      body = body.concat(content(doc, op.requestBody.content));
+    }
+    body.push(el('h4', {}, ['Responses']));
+    Object.keys(op.responses || {}).sort().forEach(function (status) {
+      var response = op.responses[status];
+      body.push(el('p', {}, [el('strong', {}, [status]), ' ' + response.description]));
+      body = body.concat(content(doc, response.content));
+    });
+    return el('details', {}, [
+      el('summary', {}, [el('span', {'class': 'method ' + method}, [method]), path]),
+      el('div', {}, body)
+    ]);
+  }
+
+  function render(doc) {
+    var title = el('h1', {}, [doc.info.title + ' ', el('small', {}, [doc.info.version])]);
+    document.title = doc.info.title;
+    root.appendChild(title);
+    Object.keys(doc.paths || {}).sort().forEach(function (path) {
+      var item = doc.paths[path];
+      methods.forEach(function (method) {
+        if (item[method]) {
+          root.appendChild(operation(doc, path, method, item[method]));
+        }
+      });
+    });
+  }
+
+  fetch(root.getAttribute('data-spec'), {headers: {'Accept': 'application/json'}})
+    .then(function (resp) {
+      if (!resp.ok) {
+        throw new Error(resp.status + ' ' + resp.statusText);
+      }
+      return resp.json();
+    })
+    .then(render)
+    .catch(function (err) {
+      root.appendChild(el('p', {'class': 'error'}, ['Failed to load the OpenAPI document: ' + err.message]));
+    });
+})();
@@ -16,88 +16,80 @@ type Handler[I any, O any] func(ctx *Context, in I) (O, error)
 
 type ErrorHandler func(ctx *Context, err error)
 
-var defaultErrHandler = func(ctx *Context, err error) {
-	var leiErr *errs.Err
-	statusCode := http.StatusInternalServerError
-	if errors.As(err, &leiErr) {
-		if leiErr.Status > 0 {
-			statusCode = leiErr.Status
-		}
-	}
-	ctx.Writer.WriteHeader(statusCode)
-	ctx.Writer.Header().Set("Content-Type", MimeJson)
-	ctx.Writer.Write([]byte(leiErr.Error()))
-}
-
 type Endpoint[I any, O any] struct {
-	Name         string
-	Pattern      string
-	Methods      []string
-	Handler      Handler[I, O]
+	Name string
+	// uri pattern of the endpoint, the sections between slashes are tried in the order of:
+	// static text (users), mixed text (v{version:~\d+}, {name}.{ext}), %d, %s, {name:~regex}, ~regex,
+	// {name}, * (one section) and the catch-all {path...} or ** (the rest of the path, captured as "**").
+	// The rest of the path may be empty, eg. /files/{path...} matches /files/ with an empty path but not /files,
+	// tag the field with validate:"required" to reject it.
+	// The named ones are bound to the fields with the path tag of the same name.
+	Pattern string
+	Methods []string
+	Handler Handler[I, O]
+	// interceptors of this endpoint, they run after the built-in interceptors (recover, circuit breaker,
+	// rate limiter and cors), the server interceptors and the group interceptors, in the order of the slice
 	Interceptors []Interceptor
+	// whether to report all the invalid fields of the input, the mode of the server is used if not set
+	ValidationMode ValidationMode
 	// error handler for this endpoint, if not set (normally, you don’t need to set it),
 	// the error handler registered on the server will be used
 	ErrorHandler
 }
 
-func (e *Endpoint[I, O]) appendToServer(svr *Server, decrypters map[string]func(cipher []byte) ([]byte, error)) {
-	// validate endpoint methods
-	for _, mth := range e.Methods {
-		if slices.Lookup(allowedMethods, mth, func(left, right string) bool {
-			return left == right
-		}) < 0 {
-			panic("Invalid http method: " + mth)
-		}
+func (e *Endpoint[I, O]) appendToServer(svr *Server, decrypters map[string]func(cipher []byte) ([]byte, error), g *Group) error {
+	err := checkMethods(e.Name, e.Methods)
+	if err != nil {
+		return err
 	}
-
-	// validate endpoint input type
-	var input I
-	inputType := reflect.TypeOf(input)
-	for inputType.Kind() == reflect.Pointer {
-		inputType = inputType.Elem()
-	}
-	if inputType.Kind() != reflect.Struct {
-		log.Panic("Endpoint ({0}) input type must be a struct, but got: [{1}]", e.Name, inputType)
+	inputType, err := inputStructType[I](e.Name)
+	if err != nil {
+		return err
 	}
 
 	r := &refinedEndpoint{
-		name:    e.Name,
-		pattern: e.Pattern,
-		methods: e.Methods,
+		name:       e.Name,
+		pattern:    g.pattern(e.Pattern),
+		methods:    e.Methods,
+		inputType:  inputType,
+		outputType: reflect.TypeOf((*O)(nil)).Elem(),
 	}
 
-	validateFunc := svr.buildInputEntityValidateFuncs(inputType)
+	validateFunc, err := svr.buildValidateFuncs(e.Name, inputType, e.ValidationMode)
+	if err != nil {
+		return err
+	}
+
+	envelope, err := newResponseEnvelope(r.outputType)
+	if err != nil {
+		return errs.Wrap(err, "Invalid output type of endpoint [{0}]", e.Name)
+	}
+	if envelope != nil {
+		r.outputType, r.envelope = envelope.bodyType(), envelope
+	}
 
 	httpHandler := func(ctx *Context) error {
-		var in I
-		err := parseHttpRequest(&in, ctx.Request, decrypters)
-		if err != nil {
-			return errs.Wrap(err, "Failed to parse request of endpoint [{0}]", e.Name).WithStatus(http.StatusBadRequest)
-		}
-		err = validateFunc(ctx, reflect.ValueOf(in))
+		in, err := parseInput[I](ctx, svr, r.name, decrypters, validateFunc)
 		if err != nil {
 			return err
 		}
 
-		if svr.Debug {
-			inputStr, _ := json.Marshal(in)
-			log.Debug(`Endpoint [{0}] input: {1}`, r.name, inputStr)
-		}
-
 		out, err := e.Handler(ctx, in)
 		if err != nil {
 			if svr.Debug {
 				log.ErrorErrF(`Endpoint [{0}] failed to process the request`, err, r.name)
 			}
-			newRequest := ctx.Request.WithContext(context.WithValue(ctx, ctxKeyEndpointError, err))
-			*ctx.Request = *newRequest
+			markEndpointError(ctx, err)
 			return err
 		}
 
+		if svr.Debug {
+			log.Debug(`Endpoint [{0}], output: {1}`, r.name, out)
+		}
+		if envelope != nil {
+			return envelope.write(ctx, reflect.ValueOf(out))
+		}
 		if !reflect.ValueOf(out).IsZero() {
-			if svr.Debug {
-				log.Debug(`Endpoint [{0}], output: {1}`, r.name, out)
-			}
 			responseContentType := ctx.Value(ctxKeyAcceptType).(string)
 			ctx.Writer.Header().Set("Content-Type", responseContentType)
 			serializer := ctx.Value(ctxKeySerializer).(Serializer)
@@ -111,40 +103,116 @@ func (e *Endpoint[I, O]) appendToServer(svr *Server, decrypters map[string]func(
 		return nil
 	}
 
+	r.httpHandler = svr.wrapHandler(r, g, e.Interceptors, e.ErrorHandler, httpHandler)
+	svr.endpoints = append(svr.endpoints, r)
+	return nil
+}
+
+func checkMethods(endpointName string, methods []string) error {
+	for _, mth := range methods {
+		if slices.Lookup(allowedMethods, mth, func(left, right string) bool {
+			return left == right
+		}) < 0 {
+			return errs.New("Invalid http method [{0}] of endpoint [{1}]", mth, endpointName)
+		}
+	}
+	return nil
+}
+
+// inputStructType returns the struct type of the endpoint input
+func inputStructType[I any](endpointName string) (reflect.Type, error) {
+	inputType := reflect.TypeOf((*I)(nil)).Elem()
+	for inputType.Kind() == reflect.Pointer {
+		inputType = inputType.Elem()
+	}
+	if inputType.Kind() != reflect.Struct {
+		return nil, errs.New("Endpoint ({0}) input type must be a struct, but got: [{1}]", endpointName, inputType)
+	}
+	return inputType, nil
+}
+
+// parseInput binds the request to the endpoint input and validates it
+func parseInput[I any](ctx *Context, svr *Server, endpointName string, decrypters map[string]func(cipher []byte) ([]byte, error), validateFunc ObjectValidateFunc) (I, error) {
+	var in I
+	err := parseHttpRequest(&in, ctx.Request, decrypters)
+	if err != nil {
+		// keep the status reported by the deserializers, eg. 413 for too large uploads
+		status := http.StatusBadRequest
+		var leiErr *errs.Err
+		if errors.As(err, &leiErr) && leiErr.Status > 0 {
+			status = leiErr.Status
+		}
+		return in, errs.Wrap(err, "Failed to parse request of endpoint [{0}]", endpointName).WithStatus(status)
+	}
+	err = validateFunc(ctx, reflect.ValueOf(in))
+	if err != nil {
+		return in, err
+	}
+
+	if svr.Debug {
+		inputStr, _ := json.Marshal(in)
+		log.Debug(`Endpoint [{0}] input: {1}`, endpointName, inputStr)
+	}
+	return in, nil
+}
+
+// markEndpointError records the error of the endpoint handler, which is inspected by the circuit breaker
+func markEndpointError(ctx *Context, err error) {
+	// derive from the request context rather than ctx itself, which delegates to the request context
+	newRequest := ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), ctxKeyEndpointError, err))
+	*ctx.Request = *newRequest
+}
+
+// wrapHandler wraps the endpoint handler with the interceptors and the error handler.
+// The interceptors run in the order of: the built-in ones (recover, circuit breaker, rate limiter and cors),
+// the ones of the server, the ones of the groups (outermost first) and the ones of the endpoint.
+// The names of the interceptors are recorded in the endpoint for the route listing.
+func (s *Server) wrapHandler(ep *refinedEndpoint, g *Group, interceptors []Interceptor, errHandler ErrorHandler, httpHandler func(*Context) error) func(*Context) error {
 	ics := []Interceptor{recoverInterceptor}
-	circuitBreaker := newCircuitBreakerInterceptor(r.name)
+	circuitBreaker := newCircuitBreakerInterceptor(ep.name)
 	ics = append(ics, circuitBreaker)
-	rateLimiter := newRateLimiterInterceptor(r.name)
+	rateLimiter := newRateLimiterInterceptor(ep.name)
 	ics = append(ics, rateLimiter)
 	corsInterceptor := newCorsInterceptor()
 	if corsInterceptor != nil {
 		ics = append(ics, corsInterceptor)
 	}
+	ics = append(ics, s.Interceptors...)
+	ics = append(ics, g.interceptors()...)
+	ics = append(ics, interceptors...)
+	ep.interceptors = interceptorNames(ics)
 	for i := len(ics); i > 0; i-- {
 		ic := ics[i-1]
 		httpHandler = ic(httpHandler)
 	}
-	errHandler := e.ErrorHandler
 	if errHandler == nil {
-		errHandler = svr.ErrorHandler
+		errHandler = g.errorHandler()
+	}
+	if errHandler == nil {
+		errHandler = s.ErrorHandler
 	}
 	if errHandler == nil {
 		errHandler = defaultErrHandler
 	}
-	r.httpHandler = func(ctx *Context) error {
+	return func(ctx *Context) error {
 		err := httpHandler(ctx)
 		if err != nil {
 			errHandler(ctx, err)
 		}
 		return nil
 	}
-
-	svr.endpoints = append(svr.endpoints, r)
 }
 
 type refinedEndpoint struct {
 	name        string
 	pattern     string
 	methods     []string
+	inputType   reflect.Type
+	outputType  reflect.Type
+	outputMime  string            // the media type of the response if it is fixed, eg. text/event-stream
+	envelope    *responseEnvelope // the envelope of the output, nil if the output is the body
+	websocket   bool              // whether the endpoint upgrades the connection to WebSocket
 	httpHandler func(ctx *Context) error
+	// names of the interceptors wrapping the handler, outermost first
+	interceptors []string
 }
@@ -1,12 +1,135 @@
 package sprout
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/log"
 )
 
 var (
 	ErrRateLimited   = errs.New("Too many request").WithCode("RATE_LIMITED").WithStatus(http.StatusTooManyRequests)
 	ErrCircuitBroken = errs.New("The request was blocked").WithCode("CIRCUIT_BROKEN").WithStatus(http.StatusInternalServerError)
 )
+
+const MimeProblemJson = "application/problem+json"
+
+// Problem is the error response body defined by RFC 9457
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// the code of the errs.Err
+	Code string `json:"code,omitempty"`
+	// the errors of the input fields
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is the error of an input field
+type FieldError struct {
+	// path of the field, eg. address.city
+	Field string `json:"field"`
+	// the validate rule failed, eg. required
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects the errors of the input fields, it is rendered as a 400 problem with the field errors
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, fe := range v {
+		msgs[i] = fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// NewProblem converts the error to a problem of the request. The status and the code are taken from the errs.Err,
+// 500 is used for the other errors. The detail consists of the messages of the error chain for the client errors,
+// and only the outermost message for the server errors, so that the internal causes are not exposed.
+func NewProblem(r *http.Request, err error) *Problem {
+	p := &Problem{Type: "about:blank", Status: http.StatusInternalServerError}
+	if r != nil && r.URL != nil {
+		p.Instance = r.URL.Path
+	}
+	var leiErr *errs.Err
+	if errors.As(err, &leiErr) && leiErr.Status > 0 {
+		p.Status = leiErr.Status
+	}
+	var fieldErrs ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		p.Errors = fieldErrs
+		if leiErr == nil {
+			p.Status = http.StatusBadRequest
+		}
+	}
+	p.Title = http.StatusText(p.Status)
+
+	var msgs []string
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if le, ok := e.(*errs.Err); ok {
+			if p.Code == "" {
+				p.Code = le.Code
+			}
+			if le.Message != "" {
+				msgs = append(msgs, le.Message)
+			}
+		} else if _, ok := e.(ValidationErrors); ok {
+			// listed in the errors member
+			break
+		} else if p.Status < http.StatusInternalServerError {
+			msgs = append(msgs, e.Error())
+			break
+		}
+	}
+	if p.Status >= http.StatusInternalServerError && len(msgs) > 1 {
+		msgs = msgs[:1]
+	}
+	p.Detail = strings.Join(msgs, ": ")
+	return p
+}
+
+// problemMediaType returns the media type of the problem in the negotiated format,
+// eg. application/problem+json for JSON and application/problem+xml for XML
+func problemMediaType(acceptType string) string {
+	subtype, ok := strings.CutPrefix(acceptType, "application/")
+	if !ok {
+		return acceptType
+	}
+	if idx := strings.LastIndexByte(subtype, '+'); idx >= 0 {
+		subtype = subtype[idx+1:]
+	}
+	switch subtype {
+	case "json", "xml", "cbor":
+		return "application/problem+" + subtype
+	}
+	return acceptType
+}
+
+// writeProblem renders the error as a problem with the serializer negotiated for the request
+func writeProblem(w http.ResponseWriter, r *http.Request, err error, serializer Serializer, acceptType string) {
+	if serializer == nil {
+		serializer, acceptType = SerializeJson, MimeJson
+	}
+	p := NewProblem(r, err)
+	if p.Status >= http.StatusInternalServerError {
+		log.ErrorErrF("Request [{0} {1}] failed", err, r.Method, r.URL.Path)
+	}
+	w.Header().Set("Content-Type", problemMediaType(acceptType))
+	w.WriteHeader(p.Status)
+	if er := serializer(p, w); er != nil {
+		log.ErrorErrF("Failed to serialize the problem", er)
+	}
+}
+
+// defaultErrHandler renders the error as an RFC 9457 problem, in application/problem+json by default
+var defaultErrHandler = func(ctx *Context, err error) {
+	serializer, _ := ctx.Value(ctxKeySerializer).(Serializer)
+	acceptType, _ := ctx.Value(ctxKeyAcceptType).(string)
+	writeProblem(ctx.Writer, ctx.Request, err, serializer, acceptType)
+}
@@ -0,0 +1,71 @@
+package sprout
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/wxy365/basal/errs"
+)
+
+func TestNewProblem(t *testing.T) {
+	fieldErrs := ValidationErrors{{Field: "name", Rule: "required", Message: "name is required"}}
+	conflict := fmt.Errorf("update user: %w", errs.New("Version conflict").WithStatus(http.StatusConflict))
+	for _, c := range []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+		errors []FieldError
+	}{
+		// the details of the server errors are hidden
+		{"plain error", errors.New("dial tcp 10.0.0.1:5432: connection refused"), http.StatusInternalServerError, "", "", nil},
+		{"wrapped plain error", errs.Wrap(errors.New("connection refused"), "Failed to query"), http.StatusInternalServerError, "", "Failed to query", nil},
+		{"server error chain", errs.Wrap(errs.New("Table [users] is locked"), "Failed to query"), http.StatusInternalServerError, "", "Failed to query", nil},
+		{"circuit broken", ErrCircuitBroken, http.StatusInternalServerError, "CIRCUIT_BROKEN", "The request was blocked", nil},
+		// the client errors are detailed
+		{"status and code", errs.New("User [{0}] not found", "1").WithStatus(http.StatusNotFound).WithCode("NOT_FOUND"), http.StatusNotFound, "NOT_FOUND", "User [1] not found", nil},
+		{"client error chain", errs.Wrap(errors.New("unexpected EOF"), "Invalid body").WithStatus(http.StatusBadRequest), http.StatusBadRequest, "", "Invalid body: unexpected EOF", nil},
+		{"inner code", errs.Wrap(errs.New("Expired").WithCode("EXPIRED"), "Invalid token").WithStatus(http.StatusUnauthorized), http.StatusUnauthorized, "EXPIRED", "Invalid token: Expired", nil},
+		// the message of a plain wrapper includes the ones it wraps
+		{"plain wrapper", conflict, http.StatusConflict, "", conflict.Error(), nil},
+		{"rate limited", ErrRateLimited, http.StatusTooManyRequests, "RATE_LIMITED", "Too many request", nil},
+		// the field errors are listed in the errors member
+		{"validation errors", fieldErrs, http.StatusBadRequest, "", "", fieldErrs},
+		{"wrapped validation errors", errs.Wrap(fieldErrs, "Invalid input").WithStatus(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity, "", "Invalid input", fieldErrs},
+	} {
+		p := NewProblem(httptest.NewRequest(http.MethodGet, "/users/1?q=1", nil), c.err)
+		expected := &Problem{
+			Type:     "about:blank",
+			Title:    http.StatusText(c.status),
+			Status:   c.status,
+			Detail:   c.detail,
+			Instance: "/users/1",
+			Code:     c.code,
+			Errors:   c.errors,
+		}
+		if !reflect.DeepEqual(p, expected) {
+			t.Errorf("%s: expected %+v, got %+v", c.name, expected, p)
+		}
+	}
+	if p := NewProblem(nil, errors.New("boom")); p.Instance != "" || p.Status != http.StatusInternalServerError {
+		t.Errorf("expected a problem without instance, got %+v", p)
+	}
+}
+
+func TestProblemMediaType(t *testing.T) {
+	for acceptType, expected := range map[string]string{
+		MimeJson:                    MimeProblemJson,
+		"application/xml":           "application/problem+xml",
+		"application/vnd.acme+json": MimeProblemJson,
+		MimeText:                    MimeText,
+	} {
+		if got := problemMediaType(acceptType); got != expected {
+			t.Errorf("%s: expected %s, got %s", acceptType, expected, got)
+		}
+	}
+}
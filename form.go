@@ -0,0 +1,252 @@
+package sprout
+
+import (
+	"context"
+	"encoding"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/log"
+	"github.com/wxy365/basal/rflt"
+)
+
+const (
+	// max size of an url-encoded form body, the same as the limit of http.Request.ParseForm
+	maxFormBytes = 10 << 20
+	// max index of a slice element in an url-encoded form, eg. items[999].sku
+	maxFormSliceIndex = 999
+)
+
+// decrypters of the app, put into the request context for the deserializers to decrypt the fields with decrypt tag
+type ctxKeyTypeDecrypters struct{}
+
+var ctxKeyDecrypters ctxKeyTypeDecrypters
+
+// DeserializeUrlencodedForm binds an application/x-www-form-urlencoded body to the model.
+// The fields are named by the form tag, or by the field name if the tag is absent, and fields tagged with form:"-"
+// or bound from the path, query, header and cookie are skipped. The fields of nested structs are named like
+// address.city or address[city], the elements of slices like tags=a&tags=b, tags[]=a, items[0].sku or items[0][sku],
+// and the entries of maps like attrs[color].
+func DeserializeUrlencodedForm(r *http.Request, model any) error {
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxFormBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(raw) > maxFormBytes {
+		return errs.New("The url-encoded form is too large").WithStatus(http.StatusRequestEntityTooLarge)
+	}
+	values, err := url.ParseQuery(string(raw))
+	if err != nil {
+		return err
+	}
+	decrypters, _ := r.Context().Value(ctxKeyDecrypters).(map[string]func(cipher []byte) ([]byte, error))
+	return bindForm(reflect.ValueOf(model), newFormNode(values), decrypters)
+}
+
+// formNode is a node of the tree built from the keys of a form, eg. items[0].sku=a is stored as items -> 0 -> sku
+type formNode struct {
+	values   []string
+	children map[string]*formNode
+}
+
+func newFormNode(values url.Values) *formNode {
+	root := &formNode{}
+	for key, vals := range values {
+		n := root
+		for _, seg := range splitFormKey(key) {
+			if n.children == nil {
+				n.children = make(map[string]*formNode)
+			}
+			child := n.children[seg]
+			if child == nil {
+				child = &formNode{}
+				n.children[seg] = child
+			}
+			n = child
+		}
+		n.values = append(n.values, vals...)
+	}
+	return root
+}
+
+// splitFormKey splits keys like items[0][sku], items[0].sku or tags[] into segments, the trailing [] is dropped
+func splitFormKey(key string) []string {
+	key = strings.TrimSuffix(key, "[]")
+	key = strings.NewReplacer("][", ".", "[", ".", "]", "").Replace(key)
+	return strings.Split(key, ".")
+}
+
+// formFieldName returns the name of the struct field in a form, false if the field is not bound from the form
+func formFieldName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	for _, tag := range []string{"path", "query", "header", "cookie"} {
+		if _, ok := f.Tag.Lookup(tag); ok {
+			return "", false
+		}
+	}
+	name, ok := f.Tag.Lookup("form")
+	if !ok || name == "" {
+		return f.Name, true
+	}
+	if name == "-" {
+		return "", false
+	}
+	return name, true
+}
+
+func bindForm(v reflect.Value, n *formNode, decrypters map[string]func(cipher []byte) ([]byte, error)) error {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return errs.New("The form model must be a struct, but got [{0}]", v.Type())
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := formFieldName(f)
+		if !ok || isFormFileType(f.Type) {
+			continue
+		}
+		child := n.children[name]
+		if child == nil {
+			continue
+		}
+		err := bindFormValue(v.Field(i), child, f.Tag.Get("decrypt"), decrypters)
+		if err != nil {
+			return errs.Wrap(err, "Failed to bind form field [{0}] to [{1}.{2}]", name, t.Name(), f.Name)
+		}
+	}
+	return nil
+}
+
+func bindFormValue(fv reflect.Value, n *formNode, decryptAlg string, decrypters map[string]func(cipher []byte) ([]byte, error)) error {
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return bindFormValue(fv.Elem(), n, decryptAlg, decrypters)
+	}
+	if isFormScalar(fv) {
+		if len(n.values) == 0 {
+			return nil
+		}
+		return unmarshalFormValue(fv, n.values[0], decryptAlg, decrypters)
+	}
+
+	switch fv.Kind() {
+	case reflect.Struct:
+		return bindForm(fv, n, decrypters)
+	case reflect.Slice:
+		if len(n.children) == 0 {
+			// repeated keys, eg. tags=a&tags=b
+			s := reflect.MakeSlice(fv.Type(), len(n.values), len(n.values))
+			for i, val := range n.values {
+				if err := unmarshalFormValue(s.Index(i), val, decryptAlg, decrypters); err != nil {
+					return err
+				}
+			}
+			fv.Set(s)
+			return nil
+		}
+		// indexed keys, eg. items[0].sku=a&items[1].sku=b
+		indexes := make([]int, 0, len(n.children))
+		for key := range n.children {
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx > maxFormSliceIndex {
+				return errs.New("Invalid slice index [{0}]", key)
+			}
+			indexes = append(indexes, idx)
+		}
+		sort.Ints(indexes)
+		s := reflect.MakeSlice(fv.Type(), indexes[len(indexes)-1]+1, indexes[len(indexes)-1]+1)
+		for _, idx := range indexes {
+			if err := bindFormValue(s.Index(idx), n.children[strconv.Itoa(idx)], decryptAlg, decrypters); err != nil {
+				return errs.Wrap(err, "Failed to bind element [{0}]", idx)
+			}
+		}
+		fv.Set(s)
+		return nil
+	case reflect.Map:
+		if fv.Type().Key().Kind() != reflect.String {
+			return errs.New("The key of map [{0}] must be string", fv.Type())
+		}
+		if fv.IsNil() {
+			fv.Set(reflect.MakeMap(fv.Type()))
+		}
+		for key, child := range n.children {
+			elem := reflect.New(fv.Type().Elem()).Elem()
+			if err := bindFormValue(elem, child, decryptAlg, decrypters); err != nil {
+				return errs.Wrap(err, "Failed to bind entry [{0}]", key)
+			}
+			fv.SetMapIndex(reflect.ValueOf(key).Convert(fv.Type().Key()), elem)
+		}
+		return nil
+	}
+	return errs.New("Type [{0}] is not supported by form binding", fv.Type())
+}
+
+// isFormScalar reports whether the value is bound from a single form value
+func isFormScalar(fv reflect.Value) bool {
+	if fv.CanAddr() && fv.Addr().Type().Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()) {
+		return true
+	}
+	switch fv.Kind() {
+	case reflect.Struct, reflect.Map:
+		return false
+	case reflect.Slice:
+		return fv.Type().Elem().Kind() == reflect.Uint8
+	}
+	return true
+}
+
+func unmarshalFormValue(fv reflect.Value, str, decryptAlg string, decrypters map[string]func(cipher []byte) ([]byte, error)) error {
+	if decryptAlg != "" {
+		if fn, exists := decrypters[decryptAlg]; exists {
+			plain, err := fn([]byte(str))
+			if err != nil {
+				log.WarnErrF("Failed to decrypt form value of type [{0}]", err, fv.Type())
+			} else {
+				str = string(plain)
+			}
+		}
+	}
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+	if u, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(str))
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		// set directly, as quotes and backslashes in the value are not escaped by rflt.UnmarshalValue
+		fv.SetString(str)
+		return nil
+	case reflect.Slice:
+		fv.SetBytes([]byte(str))
+		return nil
+	}
+	return rflt.UnmarshalValue(fv, str)
+}
+
+// withDecrypters puts the decrypters of the app into the request context
+func withDecrypters(r *http.Request, decrypters map[string]func(cipher []byte) ([]byte, error)) *http.Request {
+	if len(decrypters) == 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), ctxKeyDecrypters, decrypters))
+}
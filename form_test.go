@@ -0,0 +1,122 @@
+package sprout
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wxy365/basal/errs"
+)
+
+type formTestAddress struct {
+	City string `form:"city"`
+	Zip  *int   `form:"zip"`
+}
+
+type formTestItem struct {
+	Sku   string  `form:"sku"`
+	Price float64 `form:"price"`
+}
+
+type formTestModel struct {
+	Id       string            `path:"id"`
+	Name     string            `form:"name"`
+	Age      int               `form:"age"`
+	Tags     []string          `form:"tags"`
+	Address  formTestAddress   `form:"address"`
+	Items    []formTestItem    `form:"items"`
+	Attrs    map[string]string `form:"attrs"`
+	Password string            `form:"password" decrypt:"rev"`
+	Skipped  string            `form:"-"`
+	Plain    string
+}
+
+func deserializeForm(body string, decrypters map[string]func(cipher []byte) ([]byte, error)) (formTestModel, error) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r = withDecrypters(r, decrypters)
+	var m formTestModel
+	err := DeserializeUrlencodedForm(r, &m)
+	return m, err
+}
+
+func TestDeserializeUrlencodedForm(t *testing.T) {
+	zip := 100000
+	for _, c := range []struct {
+		name     string
+		body     string
+		expected formTestModel
+	}{
+		{"scalars", "name=sprout&age=3&Plain=x&Skipped=y&id=1", formTestModel{Name: "sprout", Age: 3, Plain: "x"}},
+		{"quotes kept", `name=%22a%5Cb%22`, formTestModel{Name: `"a\b"`}},
+		{"repeated keys", "tags=a&tags=b", formTestModel{Tags: []string{"a", "b"}}},
+		{"trailing brackets", "tags[]=a&tags[]=b", formTestModel{Tags: []string{"a", "b"}}},
+		{"nested dots", "address.city=Paris&address.zip=100000", formTestModel{Address: formTestAddress{City: "Paris", Zip: &zip}}},
+		{"nested brackets", "address[city]=Paris", formTestModel{Address: formTestAddress{City: "Paris"}}},
+		{
+			"indexed slices",
+			"items[1].sku=b&items[0][sku]=a&items[0][price]=1.5",
+			formTestModel{Items: []formTestItem{{Sku: "a", Price: 1.5}, {Sku: "b"}}},
+		},
+		{"maps", "attrs[color]=red&attrs[size]=L", formTestModel{Attrs: map[string]string{"color": "red", "size": "L"}}},
+	} {
+		m, err := deserializeForm(c.body, nil)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, c.expected) {
+			t.Errorf("%s: expected %+v, got %+v", c.name, c.expected, m)
+		}
+	}
+}
+
+func TestDeserializeUrlencodedFormInvalid(t *testing.T) {
+	for _, body := range []string{
+		"age=three",
+		"items[x].sku=a",
+		"items[-1].sku=a",
+		// the index is capped, so that a small body cannot allocate a huge slice
+		"items[1000].sku=a",
+		"name=%zz",
+	} {
+		if _, err := deserializeForm(body, nil); err == nil {
+			t.Errorf("expected %s to be rejected", body)
+		}
+	}
+	if m, err := deserializeForm("items[999].sku=a", nil); err != nil || len(m.Items) != 1000 {
+		t.Errorf("expected the max index to be accepted, got %d items, %v", len(m.Items), err)
+	}
+
+	var model struct{ Name string }
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("Name="+strings.Repeat("a", maxFormBytes)))
+	var leiErr *errs.Err
+	if err := DeserializeUrlencodedForm(r, &model); !errors.As(err, &leiErr) || leiErr.Status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a too large form to be rejected with 413, got %v", err)
+	}
+}
+
+func TestDeserializeUrlencodedFormDecrypt(t *testing.T) {
+	decrypters := map[string]func(cipher []byte) ([]byte, error){
+		"rev": func(cipher []byte) ([]byte, error) {
+			plain := make([]byte, len(cipher))
+			for i, b := range cipher {
+				plain[len(cipher)-1-i] = b
+			}
+			return plain, nil
+		},
+	}
+	m, err := deserializeForm("password=terces&name=terces", decrypters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Password != "secret" || m.Name != "terces" {
+		t.Errorf("expected only the tagged field to be decrypted, got %+v", m)
+	}
+	// the cipher is kept if no decrypter is registered
+	if m, _ = deserializeForm("password=terces", nil); m.Password != "terces" {
+		t.Errorf("expected the cipher to be kept, got %s", m.Password)
+	}
+}
@@ -8,6 +8,7 @@ require (
 	github.com/sony/gobreaker v1.0.0
 	github.com/wxy365/basal v0.0.0-20241113160748-17dda0a8985d
 	golang.org/x/net v0.28.0
+	golang.org/x/text v0.17.0
 	golang.org/x/time v0.5.0
 )
 
@@ -25,7 +26,6 @@ require (
 	golang.org/x/exp v0.0.0-20240506185415-9bf2ced13842 // indirect
 	golang.org/x/mod v0.17.0 // indirect
 	golang.org/x/sys v0.23.0 // indirect
-	golang.org/x/text v0.17.0 // indirect
 	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
 
 )
@@ -0,0 +1,115 @@
+package sprout
+
+import (
+	"strings"
+
+	"github.com/wxy365/basal/errs"
+)
+
+// Mountable is implemented by the endpoints which can be mounted into a Group
+type Mountable interface {
+	appendToServer(svr *Server, decrypters map[string]func(cipher []byte) ([]byte, error), g *Group) error
+}
+
+// Group collects endpoints sharing the same path prefix, interceptors and error handler.
+// Groups can be nested, an endpoint mounted into a group inherits the prefix, the interceptors
+// and the error handler of the group and all of its ancestors.
+type Group struct {
+	Prefix string
+	// interceptors applied to every endpoint of the group, the ones of the parent group run first
+	Interceptors []Interceptor
+	// error handler for the endpoints of this group, if not set, the error handler of the
+	// parent group will be used, and then the one registered on the server
+	ErrorHandler
+
+	parent    *Group
+	children  []*Group
+	endpoints []Mountable
+}
+
+// Mount adds endpoints into the group
+func (g *Group) Mount(endpoints ...Mountable) *Group {
+	g.endpoints = append(g.endpoints, endpoints...)
+	return g
+}
+
+// Group nests the child group into g and returns the child. A group can be nested only once, and never into
+// itself or its descendants, the misuse is reported when the outermost group is mounted.
+func (g *Group) Group(child *Group) *Group {
+	if child.parent == nil && !child.isAncestorOf(g) {
+		child.parent = g
+	}
+	g.children = append(g.children, child)
+	return child
+}
+
+// isAncestorOf reports whether g is the group itself or one of its ancestors
+func (g *Group) isAncestorOf(group *Group) bool {
+	for ; group != nil; group = group.parent {
+		if group == g {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Group) mountTo(svr *Server, decrypters map[string]func(cipher []byte) ([]byte, error)) error {
+	for _, child := range g.children {
+		if child.parent == nil {
+			return errs.New("Group [{0}] cannot be nested into itself or its descendants", child.Prefix)
+		}
+		if child.parent != g {
+			return errs.New("Group [{0}] has already been nested into group [{1}]", child.Prefix, child.parent.Prefix)
+		}
+	}
+	for _, e := range g.endpoints {
+		if err := e.appendToServer(svr, decrypters, g); err != nil {
+			return err
+		}
+	}
+	for _, child := range g.children {
+		if err := child.mountTo(svr, decrypters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pattern prepends the prefixes of g and its ancestors to the pattern
+func (g *Group) pattern(pattern string) string {
+	for ; g != nil; g = g.parent {
+		pattern = joinPattern(g.Prefix, pattern)
+	}
+	return pattern
+}
+
+// interceptors returns the interceptors of g and its ancestors, outermost first
+func (g *Group) interceptors() []Interceptor {
+	if g == nil {
+		return nil
+	}
+	return append(g.parent.interceptors(), g.Interceptors...)
+}
+
+// errorHandler returns the nearest error handler set on g or its ancestors
+func (g *Group) errorHandler() ErrorHandler {
+	for ; g != nil; g = g.parent {
+		if g.ErrorHandler != nil {
+			return g.ErrorHandler
+		}
+	}
+	return nil
+}
+
+func joinPattern(prefix, pattern string) string {
+	prefix = strings.TrimSpace(prefix)
+	pattern = strings.TrimSpace(pattern)
+	if prefix == "" || prefix == "/" {
+		return pattern
+	}
+	// the root pattern of a group denotes the prefix itself
+	if pattern == "" || pattern == "/" {
+		return prefix
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(pattern, "/")
+}
@@ -0,0 +1,136 @@
+package sprout
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type groupTestInput struct {
+	Id string `path:"id"`
+}
+
+// recordingInterceptor appends the name to the trace before the handler runs
+func recordingInterceptor(trace *[]string, name string) Interceptor {
+	return func(next func(*Context) error) func(*Context) error {
+		return func(ctx *Context) error {
+			*trace = append(*trace, name)
+			return next(ctx)
+		}
+	}
+}
+
+func statusErrorHandler(status int) ErrorHandler {
+	return func(ctx *Context, err error) {
+		ctx.Writer.WriteHeader(status)
+	}
+}
+
+func TestGroupNested(t *testing.T) {
+	var trace []string
+	handler := func(ctx *Context, in groupTestInput) (string, error) {
+		if in.Id == "0" {
+			return "", errors.New("not found")
+		}
+		return in.Id, nil
+	}
+	api := &Group{
+		Prefix:       "/api",
+		Interceptors: []Interceptor{recordingInterceptor(&trace, "api")},
+		ErrorHandler: statusErrorHandler(http.StatusTeapot),
+	}
+	v1 := api.Group(&Group{
+		Prefix:       "v1/",
+		Interceptors: []Interceptor{recordingInterceptor(&trace, "v1")},
+	})
+	admin := v1.Group(&Group{
+		Prefix:       "/admin",
+		ErrorHandler: statusErrorHandler(http.StatusConflict),
+	})
+	api.Mount(&Endpoint[groupTestInput, string]{
+		Name:    "root",
+		Pattern: "/",
+		Methods: []string{http.MethodGet},
+		Handler: func(ctx *Context, in groupTestInput) (string, error) { return "root", nil },
+	})
+	v1.Mount(&Endpoint[groupTestInput, string]{
+		Name:         "user",
+		Pattern:      "/users/{id}",
+		Methods:      []string{http.MethodGet},
+		Handler:      handler,
+		Interceptors: []Interceptor{recordingInterceptor(&trace, "endpoint")},
+	})
+	admin.Mount(&Endpoint[groupTestInput, string]{
+		Name:    "setting",
+		Pattern: "/settings/{id}",
+		Methods: []string{http.MethodGet},
+		Handler: handler,
+	})
+
+	svr := newDefaultServer("test")
+	svr.Interceptors = []Interceptor{recordingInterceptor(&trace, "server")}
+	if err := api.mountTo(svr, nil); err != nil {
+		t.Fatal(err)
+	}
+	mx := newServerTestMux(t, svr)
+
+	for _, c := range []struct {
+		path   string
+		status int
+		trace  []string
+	}{
+		{"/api", http.StatusOK, []string{"server", "api"}},
+		{"/api/v1/users/1", http.StatusOK, []string{"server", "api", "v1", "endpoint"}},
+		// the error handler is inherited from the outermost group
+		{"/api/v1/users/0", http.StatusTeapot, []string{"server", "api", "v1", "endpoint"}},
+		// the nearest error handler wins
+		{"/api/v1/admin/settings/0", http.StatusConflict, []string{"server", "api", "v1"}},
+		{"/v1/users/1", http.StatusNotFound, nil},
+	} {
+		trace = nil
+		w := serve(mx, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if w.Code != c.status {
+			t.Errorf("%s: expected %d, got %d %s", c.path, c.status, w.Code, w.Body.String())
+		}
+		if !slices.Equal(trace, c.trace) {
+			t.Errorf("%s: expected the interceptors %v, got %v", c.path, c.trace, trace)
+		}
+	}
+
+	// the built-in interceptors run first
+	for _, ep := range svr.endpoints {
+		if ep.name != "user" {
+			continue
+		}
+		builtIn := []string{"sprout.recoverInterceptor", "sprout.newCircuitBreakerInterceptor", "sprout.newRateLimiterInterceptor", "sprout.newCorsInterceptor"}
+		if len(ep.interceptors) != len(builtIn)+4 || !slices.Equal(ep.interceptors[:len(builtIn)], builtIn) {
+			t.Errorf("expected the built-in interceptors %v first, got %v", builtIn, ep.interceptors)
+		}
+	}
+}
+
+func TestGroupNestedTwice(t *testing.T) {
+	shared := &Group{Prefix: "/shared"}
+	a := &Group{Prefix: "/a"}
+	b := &Group{Prefix: "/b"}
+	a.Group(shared)
+	b.Group(shared)
+	if err := a.mountTo(newDefaultServer("test"), nil); err != nil {
+		t.Errorf("expected the group nested first to be mounted, got %v", err)
+	}
+	err := b.mountTo(newDefaultServer("test"), nil)
+	if err == nil || !strings.Contains(err.Error(), "already been nested") {
+		t.Errorf("expected the group nested twice to fail, got %v", err)
+	}
+
+	c := &Group{Prefix: "/c"}
+	d := c.Group(&Group{Prefix: "/d"})
+	d.Group(c)
+	err = c.mountTo(newDefaultServer("test"), nil)
+	if err == nil || !strings.Contains(err.Error(), "itself or its descendants") {
+		t.Errorf("expected the group nested into its descendant to fail, got %v", err)
+	}
+}
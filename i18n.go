@@ -3,7 +3,6 @@ package sprout
 import (
 	"embed"
 
-	"github.com/wxy365/basal/i18n"
 	"github.com/wxy365/basal/log"
 )
 
@@ -11,7 +10,7 @@ import (
 var fs embed.FS
 
 func init() {
-	err := i18n.AddMessagesFromEmbedFS(fs)
+	err := AddMessageBundle(fs)
 	if err != nil {
 		log.WarnErrF("Failed to load i18n resources", err)
 	}
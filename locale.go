@@ -0,0 +1,137 @@
+package sprout
+
+import (
+	"embed"
+	iofs "io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/i18n"
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is the locale of the messages if none of the requested locales is supported
+const DefaultLocale = "en"
+
+// LocaleConfig configures the negotiation of the request locales, which decides the language of the messages.
+// The locale is taken from the query parameter, the cookie and the Accept-Language header in order, the first
+// supported one wins.
+type LocaleConfig struct {
+	// the supported locales, eg. en, zh-CN, the locales of the loaded message bundles are used if empty
+	Supported []string
+	// the locale used if none of the requested locales is supported, DefaultLocale is used if empty
+	Default string
+	// name of the query parameter carrying the locale, eg. lang, the query is not checked if empty
+	QueryParam string
+	// name of the cookie carrying the locale, the cookies are not checked if empty
+	Cookie string
+}
+
+var (
+	bundleMu      sync.Mutex
+	bundleLocales []string
+)
+
+// AddMessageBundle loads the message bundles in the embedded FS, the files are named after their locales like
+// messages_en.json or messages_zh-CN.json, holding the messages by key. The messages override the loaded ones
+// of the same keys, so that apps can rephrase the built-in messages of sprout as well.
+func AddMessageBundle(efs embed.FS) error {
+	var locales []string
+	err := iofs.WalkDir(efs, ".", func(p string, d iofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".json" {
+			return err
+		}
+		name := strings.TrimSuffix(path.Base(p), ".json")
+		locale := name[strings.LastIndex(name, "_")+1:]
+		if _, err = language.Parse(locale); err != nil {
+			return errs.Wrap(err, "The message bundle [{0}] is not named after its locale", p)
+		}
+		locales = append(locales, locale)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = i18n.AddMessagesFromEmbedFS(efs); err != nil {
+		return err
+	}
+	bundleMu.Lock()
+	defer bundleMu.Unlock()
+	for _, locale := range locales {
+		if !slices.Contains(bundleLocales, locale) {
+			bundleLocales = append(bundleLocales, locale)
+		}
+	}
+	return nil
+}
+
+type ctxKeyTypeLocale struct{}
+
+var ctxKeyLocale ctxKeyTypeLocale
+
+// localeNegotiator picks the supported locale of the requests
+type localeNegotiator struct {
+	cfg     LocaleConfig
+	tags    []language.Tag
+	matcher language.Matcher
+}
+
+func newLocaleNegotiator(cfg LocaleConfig) (*localeNegotiator, error) {
+	supported := cfg.Supported
+	if len(supported) == 0 {
+		bundleMu.Lock()
+		supported = slices.Clone(bundleLocales)
+		bundleMu.Unlock()
+	}
+	if cfg.Default == "" {
+		cfg.Default = DefaultLocale
+	}
+	// the default locale goes first, as the matcher falls back to the first tag
+	n := &localeNegotiator{cfg: cfg}
+	for _, locale := range append([]string{cfg.Default}, supported...) {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return nil, errs.Wrap(err, "Invalid locale [{0}]", locale)
+		}
+		if !slices.Contains(n.tags, tag) {
+			n.tags = append(n.tags, tag)
+		}
+	}
+	n.matcher = language.NewMatcher(n.tags)
+	return n, nil
+}
+
+// negotiate returns the locale of the request, eg. zh-CN
+func (n *localeNegotiator) negotiate(r *http.Request) string {
+	if n == nil {
+		return DefaultLocale
+	}
+	var requested []string
+	if n.cfg.QueryParam != "" {
+		requested = append(requested, r.URL.Query().Get(n.cfg.QueryParam))
+	}
+	if n.cfg.Cookie != "" {
+		if c, err := r.Cookie(n.cfg.Cookie); err == nil {
+			requested = append(requested, c.Value)
+		}
+	}
+	requested = append(requested, r.Header.Get("Accept-Language"))
+	for _, locales := range requested {
+		if locales == "" {
+			continue
+		}
+		desired, _, err := language.ParseAcceptLanguage(locales)
+		if err != nil || len(desired) == 0 {
+			continue
+		}
+		// the matched tag may carry extensions, take the supported one by index
+		if _, idx, confidence := n.matcher.Match(desired...); confidence != language.No {
+			return n.tags[idx].String()
+		}
+	}
+	return n.tags[0].String()
+}
@@ -0,0 +1,133 @@
+package sprout
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wxy365/basal/i18n"
+)
+
+//go:embed testdata/i18n
+var localeTestBundle embed.FS
+
+type localeTestInput struct {
+	Name string `json:"name" validate:"required" label:"app.user.name"`
+	Age  int    `json:"age" validate:"min=1"`
+}
+
+func TestLocaleMessages(t *testing.T) {
+	if err := AddMessageBundle(localeTestBundle); err != nil {
+		t.Fatal(err)
+	}
+	svr := newDefaultServer("test")
+	svr.ValidationMode = ValidationAggregate
+	svr.Locale = LocaleConfig{QueryParam: "lang", Cookie: "lang"}
+	mx := newServerTestMux(t, svr,
+		&Endpoint[localeTestInput, string]{
+			Name:    "user",
+			Pattern: "/users",
+			Methods: []string{http.MethodPost},
+			Handler: func(ctx *Context, in localeTestInput) (string, error) { return in.Name, nil },
+		},
+		&Endpoint[responseTestInput, string]{
+			Name:    "locale",
+			Pattern: "/locale",
+			Methods: []string{http.MethodGet},
+			Handler: func(ctx *Context, in responseTestInput) (string, error) { return ctx.Locale(), nil },
+		},
+	)
+
+	for _, c := range []struct {
+		name     string
+		query    string
+		cookie   string
+		accept   string
+		locale   string
+		messages []string
+	}{
+		{"default", "", "", "", "en", []string{"The user name is required", "The Age should be at least 1"}},
+		{"unsupported", "", "", "fr-FR", "en", []string{"The user name is required"}},
+		{"accept-language", "", "", "fr;q=0.9, zh-CN;q=0.8", "zh", []string{"用户名 是必须的", "参数错误"}},
+		{"query parameter", "?lang=zh", "", "en", "zh", []string{"用户名 是必须的"}},
+		{"cookie", "", "zh", "en", "zh", []string{"用户名 是必须的"}},
+		// the query parameter takes precedence over the cookie
+		{"query over cookie", "?lang=en", "zh", "zh", "en", []string{"The user name is required"}},
+	} {
+		for _, r := range []*http.Request{
+			httptest.NewRequest(http.MethodGet, "/locale"+c.query, nil),
+			httptest.NewRequest(http.MethodPost, "/users"+c.query, strings.NewReader(`{}`)),
+		} {
+			r.Header.Set("Content-Type", MimeJson)
+			if c.accept != "" {
+				r.Header.Set("Accept-Language", c.accept)
+			}
+			if c.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "lang", Value: c.cookie})
+			}
+			w := serve(mx, r)
+			if r.URL.Path == "/locale" {
+				if body := strings.TrimSpace(w.Body.String()); body != `"`+c.locale+`"` {
+					t.Errorf("%s: expected the locale %s, got %s", c.name, c.locale, body)
+				}
+				continue
+			}
+			for _, msg := range c.messages {
+				if !strings.Contains(w.Body.String(), msg) {
+					t.Errorf("%s: expected the message %q, got %s", c.name, msg, w.Body.String())
+				}
+			}
+		}
+	}
+}
+
+func TestLocaleLabels(t *testing.T) {
+	if err := AddMessageBundle(localeTestBundle); err != nil {
+		t.Fatal(err)
+	}
+	vf, err := newDefaultServer("test").buildValidateFuncs("test", reflect.TypeOf(localeTestInput{}), ValidationDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for locale, expected := range map[string]string{
+		"en": "The user name is required",
+		"zh": "用户名 是必须的",
+	} {
+		ctx := i18n.WithLocale(context.Background(), locale)
+		if label := fieldLabel(ctx, reflect.TypeOf(localeTestInput{}).Field(0)); !strings.Contains(expected, label) {
+			t.Errorf("%s: expected the label translated in %q, got %s", locale, expected, label)
+		}
+		var fieldErrs ValidationErrors
+		if err := vf(ctx, reflect.ValueOf(localeTestInput{Age: 1})); !errors.As(err, &fieldErrs) || fieldErrs[0].Message != expected {
+			t.Errorf("%s: expected the message %q, got %v", locale, expected, err)
+		}
+	}
+}
+
+func TestLocaleNegotiator(t *testing.T) {
+	n, err := newLocaleNegotiator(LocaleConfig{Supported: []string{"en", "zh-CN"}, Default: "zh-CN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for accept, expected := range map[string]string{
+		"":               "zh-CN",
+		"en-US,en;q=0.9": "en",
+		"zh-TW":          "zh-CN",
+		"de":             "zh-CN",
+		"invalid;;q=abc": "zh-CN",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Language", accept)
+		if locale := n.negotiate(r); locale != expected {
+			t.Errorf("%q: expected %s, got %s", accept, expected, locale)
+		}
+	}
+	if _, err = newLocaleNegotiator(LocaleConfig{Default: "not a locale!"}); err == nil {
+		t.Error("expected the invalid locale to be rejected")
+	}
+}
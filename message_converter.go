@@ -1,12 +1,17 @@
 package sprout
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/wxy365/basal/errs"
 	"github.com/wxy365/basal/log"
@@ -15,8 +20,8 @@ import (
 )
 
 var (
-	serializers   map[string]Serializer
-	deserializers map[string]Deserializer
+	serializers   MediaTypeRegistry[Serializer]
+	deserializers MediaTypeRegistry[Deserializer]
 )
 
 type Serializer func(model any, w http.ResponseWriter) error
@@ -26,7 +31,7 @@ type Deserializer func(r *http.Request, model any) error
 const (
 	MimeJson           = "application/json"
 	MimeMultipartForm  = "multipart/form-data"
-	MimeUrlencodedForm = "x-www-form-encoded"
+	MimeUrlencodedForm = "application/x-www-form-urlencoded"
 	MimeText           = "text/plain"
 	MimeHtml           = "text/html"
 	MimePdf            = "application/pdf"
@@ -115,86 +120,282 @@ func SerializeMultipartForm(model any, w http.ResponseWriter) error {
 	return nil
 }
 
-func DeserializeMultipartForm(r *http.Request, model any) error {
-	if p, ok := r.Context().Value(ctxKeyContentTypeParams).(map[string]string); ok {
-		reader := multipart.NewReader(r.Body, p["boundary"])
-		f, err := reader.ReadForm(25)
+// acceptRange is an entry of the Accept header
+type acceptRange struct {
+	typ, subtype string
+	q            float64
+	pos          int
+}
+
+// specificity of the range when it matches the media type, -1 if it does not match
+func (a acceptRange) match(mediaType string) int {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	switch {
+	case a.typ == "*" && a.subtype == "*":
+		return 0
+	case a.typ != typ:
+		return -1
+	case a.subtype == "*":
+		return 1
+	case a.subtype == subtype:
+		return 2
+	}
+	return -1
+}
+
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for i, entry := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
 		if err != nil {
-			return err
+			continue
 		}
-		defer f.RemoveAll()
-		mv := reflect.ValueOf(model).Elem()
-		for k, v := range f.Value {
-			fv := mv.FieldByName(k)
-			err = rflt.UnmarshalValue(fv, v[0])
-			if err != nil {
-				return err
-			}
+		typ, subtype, ok := strings.Cut(mediaType, "/")
+		if !ok || typ == "*" && subtype != "*" {
+			continue
 		}
-		for k, v := range f.File {
-			fv := mv.FieldByName(k)
-			if fv.Kind() == reflect.Pointer {
-				fv = fv.Elem()
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(qs, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
 			}
-			switch fv.Kind() {
-			case reflect.Slice:
-				if fv.Type().Elem().Kind() != reflect.Uint8 {
-					return errs.New(`The field [{0}] of model [{1}] is supposed to be of []byte or io.Reader type`, k, mv.Type().Name())
-				}
-				file, err := v[0].Open()
-				if err != nil {
-					return err
-				}
-				fileContent, err := io.ReadAll(file)
-				if err != nil {
-					return err
-				}
-				fv.SetBytes(fileContent)
-			case reflect.Interface:
-				var sample io.Reader
-				if !fv.Type().Implements(reflect.TypeOf(sample)) {
-					return errs.New(`The field [{0}] of model [{1}] is supposed to be of []byte or io.Reader type`, k, mv.Type().Name())
-				}
-				file, err := v[0].Open()
-				if err != nil {
-					return err
-				}
-				fv.Set(reflect.ValueOf(file))
+		}
+		ranges = append(ranges, acceptRange{typ: typ, subtype: subtype, q: q, pos: i})
+	}
+	return ranges
+}
+
+// negotiateContentType picks the media type of the response among the available ones according to the Accept header.
+// Every available type takes the quality of the most specific range matching it, the type with the highest quality wins,
+// and the ties are broken by the specificity and the position of the ranges, and then JSON is preferred.
+// JSON is picked if the Accept header is absent, false is returned if none of the available types is acceptable.
+func negotiateContentType(accept string, available []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return MimeJson, true
+	}
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return MimeJson, true
+	}
+	var (
+		best                     string
+		bestQ                    float64
+		bestSpecificity, bestPos int
+	)
+	for _, mediaType := range available {
+		matched := acceptRange{q: -1}
+		specificity := -1
+		for _, ar := range ranges {
+			if sp := ar.match(mediaType); sp > specificity {
+				matched, specificity = ar, sp
 			}
 		}
-	} else {
-		return errs.New("Form data boundary is not specified")
+		if specificity < 0 || matched.q == 0 {
+			continue
+		}
+		better := best == "" ||
+			matched.q > bestQ ||
+			matched.q == bestQ && specificity > bestSpecificity ||
+			matched.q == bestQ && specificity == bestSpecificity && matched.pos < bestPos ||
+			matched.q == bestQ && specificity == bestSpecificity && matched.pos == bestPos && mediaType == MimeJson
+		if better {
+			best, bestQ, bestSpecificity, bestPos = mediaType, matched.q, specificity, matched.pos
+		}
 	}
-	return nil
+	return best, best != ""
+}
+
+// bufferWriter collects the output of a Serializer apart from the http response, eg. the data of an event
+type bufferWriter struct {
+	bytes.Buffer
+	header http.Header
 }
 
+func (b *bufferWriter) Header() http.Header {
+	if b.header == nil {
+		b.header = make(http.Header)
+	}
+	return b.header
+}
+
+func (b *bufferWriter) WriteHeader(int) {}
+
+// RegisterSerializer registers the serializer of the media type for all servers, eg. application/xml
+// or a vendor type like application/vnd.acme+json. It panics if the media type is invalid.
+// The servers built afterwards pick it up, so it is normally called in an init function.
 func RegisterSerializer(contentType string, serializer Serializer) {
-	switch contentType {
-	case MimeJson, MimeHtml, MimeText, MimeMultipartForm, MimeUrlencodedForm, MimePdf:
-		serializers[contentType] = serializer
-	default:
-		log.Panic("Content type {0} not supported", contentType)
+	if err := serializers.Register(contentType, serializer); err != nil {
+		log.PanicErr(err)
 	}
 }
 
+// RegisterDeserializer registers the deserializer of the media type for all servers, it panics if the media type is invalid.
+// The servers built afterwards pick it up, so it is normally called in an init function.
 func RegisterDeserializer(contentType string, deserializer Deserializer) {
-	switch contentType {
-	case MimeJson, MimeHtml, MimeText, MimeMultipartForm, MimeUrlencodedForm, MimePdf:
-		deserializers[contentType] = deserializer
-	default:
-		log.Panic("Content type {0} not supported", contentType)
+	if err := deserializers.Register(contentType, deserializer); err != nil {
+		log.PanicErr(err)
 	}
 }
 
-func init() {
-	if serializers == nil {
-		serializers = make(map[string]Serializer)
+// MediaTypeRegistry maps the media types to their serializers or deserializers, it is safe for concurrent use.
+// It is shared by the server and the client, the zero value is ready to use.
+type MediaTypeRegistry[T any] struct {
+	mu     sync.RWMutex
+	codecs map[string]T
+}
+
+// Register registers the codec of the media type, the parameters of the content type are ignored
+func (r *MediaTypeRegistry[T]) Register(contentType string, codec T) error {
+	mediaType, err := NormalizeMediaType(contentType)
+	if err != nil {
+		return err
 	}
-	if deserializers == nil {
-		deserializers = make(map[string]Deserializer)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.codecs == nil {
+		r.codecs = make(map[string]T)
 	}
-	serializers[MimeJson] = SerializeJson
-	deserializers[MimeJson] = DeserializeJson
-	serializers[MimeMultipartForm] = SerializeMultipartForm
-	deserializers[MimeMultipartForm] = DeserializeMultipartForm
+	r.codecs[mediaType] = codec
+	return nil
+}
+
+// Lookup looks up the codec of the media type, falling back to the one of the structured syntax suffix,
+// eg. application/json for application/vnd.acme+json
+func (r *MediaTypeRegistry[T]) Lookup(mediaType string) (T, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return lookupMediaType(r.codecs, mediaType)
+}
+
+// snapshot copies the registered codecs
+func (r *MediaTypeRegistry[T]) snapshot() map[string]T {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	codecs := make(map[string]T, len(r.codecs))
+	for k, v := range r.codecs {
+		codecs[k] = v
+	}
+	return codecs
+}
+
+func lookupMediaType[T any](codecs map[string]T, mediaType string) (T, bool) {
+	if codec, ok := codecs[mediaType]; ok {
+		return codec, true
+	}
+	if suffix := SuffixMediaType(mediaType); suffix != "" {
+		codec, ok := codecs[suffix]
+		return codec, ok
+	}
+	var zero T
+	return zero, false
+}
+
+// NormalizeMediaType strips the parameters of the content type, it fails if the content type is not a concrete media type
+func NormalizeMediaType(contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.Contains(mediaType, "/") || strings.Contains(mediaType, "*") {
+		return "", errs.New("Invalid media type [{0}]", contentType)
+	}
+	return mediaType, nil
+}
+
+// SuffixMediaType returns the media type denoted by the structured syntax suffix (RFC 6839),
+// eg. application/json for application/vnd.acme+json, or empty if there is no suffix
+func SuffixMediaType(mediaType string) string {
+	if idx := strings.LastIndexByte(mediaType, '+'); idx >= 0 && idx < len(mediaType)-1 {
+		return "application/" + mediaType[idx+1:]
+	}
+	return ""
+}
+
+// mediaTypes holds the serializers and deserializers available to a server,
+// the ones of the server take precedence over the globally registered ones
+type mediaTypes struct {
+	serializers   map[string]Serializer
+	deserializers map[string]Deserializer
+}
+
+func newMediaTypes(svrSerializers map[string]Serializer, svrDeserializers map[string]Deserializer) (*mediaTypes, error) {
+	m := &mediaTypes{
+		serializers:   serializers.snapshot(),
+		deserializers: deserializers.snapshot(),
+	}
+	for k, v := range svrSerializers {
+		mediaType, err := NormalizeMediaType(k)
+		if err != nil {
+			return nil, err
+		}
+		m.serializers[mediaType] = v
+	}
+	for k, v := range svrDeserializers {
+		mediaType, err := NormalizeMediaType(k)
+		if err != nil {
+			return nil, err
+		}
+		m.deserializers[mediaType] = v
+	}
+	return m, nil
+}
+
+// serializer looks up the serializer of the media type, falling back to the one of the structured syntax suffix
+func (m *mediaTypes) serializer(mediaType string) Serializer {
+	s, _ := lookupMediaType(m.serializers, mediaType)
+	return s
+}
+
+// deserializer looks up the deserializer of the media type, falling back to the one of the structured syntax suffix
+func (m *mediaTypes) deserializer(mediaType string) Deserializer {
+	d, _ := lookupMediaType(m.deserializers, mediaType)
+	return d
+}
+
+// negotiate picks the media type of the response and its serializer according to the Accept header.
+// The media types explicitly accepted are considered besides the registered ones, so that a vendor type
+// like application/vnd.acme+json is served by the JSON serializer.
+func (m *mediaTypes) negotiate(accept string) (string, Serializer, bool) {
+	available := m.serializableTypes()
+	for _, ar := range parseAccept(accept) {
+		mediaType := ar.typ + "/" + ar.subtype
+		if ar.typ != "*" && ar.subtype != "*" && m.serializers[mediaType] == nil && m.serializer(mediaType) != nil {
+			available = append(available, mediaType)
+		}
+	}
+	mediaType, ok := negotiateContentType(accept, available)
+	if !ok {
+		return "", nil, false
+	}
+	return mediaType, m.serializer(mediaType), true
+}
+
+// serializableTypes returns the registered media types which have a serializer, in alphabetical order
+func (m *mediaTypes) serializableTypes() []string {
+	types := make([]string, 0, len(m.serializers))
+	for mediaType, serializer := range m.serializers {
+		if serializer != nil {
+			types = append(types, mediaType)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// deserializableTypes returns the registered media types which have a deserializer, in alphabetical order
+func (m *mediaTypes) deserializableTypes() []string {
+	types := make([]string, 0, len(m.deserializers))
+	for mediaType, deserializer := range m.deserializers {
+		if deserializer != nil {
+			types = append(types, mediaType)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+func init() {
+	RegisterSerializer(MimeJson, SerializeJson)
+	RegisterDeserializer(MimeJson, DeserializeJson)
+	RegisterSerializer(MimeMultipartForm, SerializeMultipartForm)
+	RegisterDeserializer(MimeMultipartForm, DeserializeMultipartForm)
+	RegisterDeserializer(MimeUrlencodedForm, DeserializeUrlencodedForm)
 }
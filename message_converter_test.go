@@ -0,0 +1,47 @@
+package sprout
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMediaTypeRegistry(t *testing.T) {
+	var r MediaTypeRegistry[string]
+	if err := r.Register("application/json; charset=utf-8", "json"); err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range []string{"json", "application/*", ""} {
+		if err := r.Register(invalid, "invalid"); err == nil {
+			t.Errorf("expected media type [%s] to be rejected", invalid)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = r.Register("application/xml", "xml")
+			r.Lookup(MimeJson)
+		}()
+	}
+	wg.Wait()
+
+	for _, c := range []struct {
+		mediaType string
+		codec     string
+		ok        bool
+	}{
+		{MimeJson, "json", true},
+		{"application/xml", "xml", true},
+		// the structured syntax suffix
+		{"application/vnd.acme+json", "json", true},
+		{"application/problem+xml", "xml", true},
+		{"application/vnd.acme+yaml", "", false},
+		{"text/plain", "", false},
+	} {
+		if codec, ok := r.Lookup(c.mediaType); codec != c.codec || ok != c.ok {
+			t.Errorf("%s: expected %q %v, got %q %v", c.mediaType, c.codec, c.ok, codec, ok)
+		}
+	}
+}
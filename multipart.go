@@ -0,0 +1,297 @@
+package sprout
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/log"
+)
+
+const (
+	// DefaultMaxUploadFileBytes is the default max size of a file uploaded in a multipart form
+	DefaultMaxUploadFileBytes int64 = 32 << 20
+	// DefaultMaxUploadBytes is the default max size of a multipart form body
+	DefaultMaxUploadBytes int64 = 64 << 20
+	// the files larger than this are spooled to temp files rather than kept in memory
+	maxMemoryFileBytes = 1 << 20
+)
+
+// FormFile is a file uploaded in a multipart form. The small files are kept in memory,
+// the large ones are spooled to temp files, which are removed once the request is handled.
+type FormFile struct {
+	Filename    string
+	Size        int64
+	ContentType string
+	Header      textproto.MIMEHeader
+
+	content []byte
+	tmpFile string
+}
+
+// Open opens the content of the file, the caller should close it
+func (f *FormFile) Open() (multipart.File, error) {
+	if f.tmpFile != "" {
+		return os.Open(f.tmpFile)
+	}
+	return memoryFile{bytes.NewReader(f.content)}, nil
+}
+
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error {
+	return nil
+}
+
+var (
+	typeFormFile      = reflect.TypeOf(FormFile{})
+	typeMultipartFile = reflect.TypeOf((*multipart.File)(nil)).Elem()
+)
+
+// upload limits of the request and the temp files created while parsing it
+type uploadState struct {
+	maxFileBytes int64
+	maxBytes     int64
+
+	mu       sync.Mutex
+	tmpFiles []string
+	closers  []io.Closer
+}
+
+type ctxKeyTypeUpload struct{}
+
+var ctxKeyUpload ctxKeyTypeUpload
+
+func newUploadState(maxFileBytes, maxBytes int64) *uploadState {
+	if maxFileBytes <= 0 {
+		maxFileBytes = DefaultMaxUploadFileBytes
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxUploadBytes
+	}
+	return &uploadState{maxFileBytes: maxFileBytes, maxBytes: maxBytes}
+}
+
+// cleanup closes the files opened for the model and removes the temp files
+func (u *uploadState) cleanup() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, c := range u.closers {
+		_ = c.Close()
+	}
+	for _, name := range u.tmpFiles {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.WarnErrF("Failed to remove the temp file [{0}] of the upload", err, name)
+		}
+	}
+	u.closers, u.tmpFiles = nil, nil
+}
+
+func (u *uploadState) addTmpFile(name string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.tmpFiles = append(u.tmpFiles, name)
+}
+
+func (u *uploadState) addCloser(c io.Closer) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.closers = append(u.closers, c)
+}
+
+func errUploadTooLarge(limit int64) error {
+	return errs.New("The upload exceeds the limit of {0} bytes", limit).WithStatus(http.StatusRequestEntityTooLarge)
+}
+
+func errFileTooLarge(filename string, limit int64) error {
+	return errs.New("The file [{0}] exceeds the limit of {1} bytes", filename, limit).WithStatus(http.StatusRequestEntityTooLarge)
+}
+
+// DeserializeMultipartForm binds a multipart/form-data body to the model, reading the parts as a stream.
+// The fields are named the same way as DeserializeUrlencodedForm. The files are bound to the fields of
+// type FormFile, *FormFile, []FormFile, []*FormFile, and for compatibility []byte and io.Reader.
+// The files larger than the per-file limit and the bodies larger than the total limit are rejected with 413,
+// without being buffered.
+func DeserializeMultipartForm(r *http.Request, model any) error {
+	p, ok := r.Context().Value(ctxKeyContentTypeParams).(map[string]string)
+	if !ok || p["boundary"] == "" {
+		return errs.New("Form data boundary is not specified")
+	}
+	upload, _ := r.Context().Value(ctxKeyUpload).(*uploadState)
+	if upload == nil {
+		// not parsed by the mux, the temp files are removed once the request context is done
+		upload = newUploadState(0, 0)
+		context.AfterFunc(r.Context(), upload.cleanup)
+	}
+	if r.ContentLength > upload.maxBytes {
+		return errUploadTooLarge(upload.maxBytes)
+	}
+
+	body := http.MaxBytesReader(nil, r.Body, upload.maxBytes)
+	reader := multipart.NewReader(body, p["boundary"])
+	values := make(url.Values)
+	files := make(map[string][]*FormFile)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return convertMaxBytesError(err, upload.maxBytes)
+		}
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+		if part.FileName() == "" {
+			var buf bytes.Buffer
+			if _, err = io.Copy(&buf, part); err != nil {
+				return convertMaxBytesError(err, upload.maxBytes)
+			}
+			values.Add(name, buf.String())
+			continue
+		}
+		file, err := readFormFile(part, upload)
+		if err != nil {
+			return convertMaxBytesError(err, upload.maxBytes)
+		}
+		files[name] = append(files[name], file)
+	}
+
+	decrypters, _ := r.Context().Value(ctxKeyDecrypters).(map[string]func(cipher []byte) ([]byte, error))
+	mv := reflect.ValueOf(model)
+	if err := bindForm(mv, newFormNode(values), decrypters); err != nil {
+		return err
+	}
+	return bindFormFiles(mv, files, upload)
+}
+
+// readFormFile keeps the file in memory if it is small, or spools it to a temp file
+func readFormFile(part *multipart.Part, upload *uploadState) (*FormFile, error) {
+	file := &FormFile{
+		Filename:    part.FileName(),
+		ContentType: part.Header.Get("Content-Type"),
+		Header:      part.Header,
+	}
+	limited := io.LimitReader(part, upload.maxFileBytes+1)
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, limited, maxMemoryFileBytes+1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if n > upload.maxFileBytes {
+		return nil, errFileTooLarge(file.Filename, upload.maxFileBytes)
+	}
+	if n <= maxMemoryFileBytes {
+		file.content, file.Size = buf.Bytes(), n
+		return file, nil
+	}
+
+	tmp, err := os.CreateTemp("", "sprout-upload-")
+	if err != nil {
+		return nil, err
+	}
+	upload.addTmpFile(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, io.MultiReader(&buf, limited))
+	if err != nil {
+		return nil, err
+	}
+	if size > upload.maxFileBytes {
+		return nil, errFileTooLarge(file.Filename, upload.maxFileBytes)
+	}
+	file.tmpFile, file.Size = tmp.Name(), size
+	return file, nil
+}
+
+func convertMaxBytesError(err error, limit int64) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return errUploadTooLarge(limit)
+	}
+	return err
+}
+
+func bindFormFiles(v reflect.Value, files map[string][]*FormFile, upload *uploadState) error {
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := formFieldName(f)
+		if !ok || len(files[name]) == 0 {
+			continue
+		}
+		if err := bindFormFile(v.Field(i), files[name], upload); err != nil {
+			return errs.Wrap(err, "Failed to bind file [{0}] to [{1}.{2}]", name, t.Name(), f.Name)
+		}
+	}
+	return nil
+}
+
+func bindFormFile(fv reflect.Value, files []*FormFile, upload *uploadState) error {
+	ft := fv.Type()
+	switch {
+	case ft == typeFormFile:
+		fv.Set(reflect.ValueOf(*files[0]))
+	case ft == reflect.PointerTo(typeFormFile):
+		fv.Set(reflect.ValueOf(files[0]))
+	case ft.Kind() == reflect.Slice && ft.Elem() == typeFormFile:
+		s := reflect.MakeSlice(ft, len(files), len(files))
+		for i, file := range files {
+			s.Index(i).Set(reflect.ValueOf(*file))
+		}
+		fv.Set(s)
+	case ft.Kind() == reflect.Slice && ft.Elem() == reflect.PointerTo(typeFormFile):
+		fv.Set(reflect.ValueOf(files))
+	case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Uint8:
+		content, err := readFormFileContent(files[0])
+		if err != nil {
+			return err
+		}
+		fv.SetBytes(content)
+	case ft.Kind() == reflect.Interface && typeMultipartFile.Implements(ft):
+		file, err := files[0].Open()
+		if err != nil {
+			return err
+		}
+		upload.addCloser(file)
+		fv.Set(reflect.ValueOf(file))
+	default:
+		return errs.New("The field is supposed to be of FormFile, []FormFile, []byte or io.Reader type, but got [{0}]", ft)
+	}
+	return nil
+}
+
+func readFormFileContent(file *FormFile) ([]byte, error) {
+	if file.tmpFile == "" {
+		return file.content, nil
+	}
+	return os.ReadFile(file.tmpFile)
+}
+
+// isUploadType reports whether the fields of the type are bound from the files of a multipart form only,
+// which are the FormFile types and the interfaces implemented by multipart.File like io.Reader
+func isUploadType(t reflect.Type) bool {
+	return isFormFileType(t) || t.Kind() == reflect.Interface && t.NumMethod() > 0 && typeMultipartFile.Implements(t)
+}
+
+// isFormFileType reports whether the fields of the type are bound from the files of a multipart form
+func isFormFileType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t == typeFormFile
+}
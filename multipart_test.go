@@ -0,0 +1,239 @@
+package sprout
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type uploadTestInput struct {
+	Title string    `form:"title"`
+	File  *FormFile `form:"file"`
+}
+
+// uploadTestPart is a file part of a multipart form
+type uploadTestPart struct {
+	field, filename, contentType string
+	content                      []byte
+}
+
+func newMultipartRequest(t *testing.T, path string, title string, parts ...uploadTestPart) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("title", title); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range parts {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="`+p.field+`"; filename="`+p.filename+`"`)
+		h.Set("Content-Type", p.contentType)
+		fw, err := mw.CreatePart(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(p.content)
+	}
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, path, &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func newUploadRequest(t *testing.T, title string, content []byte) *http.Request {
+	return newMultipartRequest(t, "/upload", title, uploadTestPart{"file", "data.bin", "application/octet-stream", content})
+}
+
+// newUploadTestMux serves the uploads at POST /upload with the handler
+func newUploadTestMux[I any](t *testing.T, svr *Server, handler Handler[I, string]) *mux {
+	t.Helper()
+	return newServerTestMux(t, svr, &Endpoint[I, string]{
+		Name:    "upload",
+		Pattern: "/upload",
+		Methods: []string{http.MethodPost},
+		Handler: handler,
+	})
+}
+
+func TestMultipartFileLimit(t *testing.T) {
+	svr := newDefaultServer("test")
+	svr.MaxUploadFileBytes = 1 << 10
+	var received []byte
+	mx := newUploadTestMux(t, svr, func(ctx *Context, in uploadTestInput) (string, error) {
+		f, err := in.File.Open()
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		received, err = io.ReadAll(f)
+		return in.Title, err
+	})
+
+	for _, size := range []int{0, 1 << 10, 1<<10 + 1, 4 << 10, 2 << 20} {
+		received = nil
+		content := bytes.Repeat([]byte{'x'}, size)
+		w := serve(mx, newUploadRequest(t, "report", content))
+		if size > 1<<10 {
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("%d bytes: expected 413, got %d %s", size, w.Code, w.Body.String())
+			}
+			if received != nil {
+				t.Errorf("%d bytes: expected the handler not to be called, got %d bytes", size, len(received))
+			}
+			continue
+		}
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "report") {
+			t.Errorf("%d bytes: expected 200, got %d %s", size, w.Code, w.Body.String())
+		}
+		if !bytes.Equal(received, content) {
+			t.Errorf("%d bytes: expected the file intact, got %d bytes", size, len(received))
+		}
+	}
+}
+
+type uploadTestFilesInput struct {
+	Title  string      `form:"title"`
+	Files  []*FormFile `form:"files"`
+	Photos []FormFile  `form:"photos"`
+}
+
+func TestMultipartTotalLimit(t *testing.T) {
+	svr := newDefaultServer("test")
+	svr.MaxUploadFileBytes = 1 << 10
+	svr.MaxUploadBytes = 2 << 10
+	var called bool
+	mx := newUploadTestMux(t, svr, func(ctx *Context, in uploadTestFilesInput) (string, error) {
+		called = true
+		return in.Title, nil
+	})
+	file := uploadTestPart{"files", "a.bin", "application/octet-stream", bytes.Repeat([]byte{'x'}, 1<<10)}
+	for _, c := range []struct {
+		name   string
+		files  int
+		stream bool
+		status int
+	}{
+		{"within the limit", 1, false, http.StatusOK},
+		{"content length", 3, false, http.StatusRequestEntityTooLarge},
+		// the body of an unknown length is rejected while being read
+		{"streamed", 3, true, http.StatusRequestEntityTooLarge},
+	} {
+		called = false
+		r := newMultipartRequest(t, "/upload", "report", slices.Repeat([]uploadTestPart{file}, c.files)...)
+		if c.stream {
+			r.ContentLength = -1
+		}
+		w := serve(mx, r)
+		if w.Code != c.status || called != (c.status == http.StatusOK) {
+			t.Errorf("%s: expected %d, got %d %s, handler called %t", c.name, c.status, w.Code, w.Body.String(), called)
+		}
+	}
+}
+
+func TestMultipartFiles(t *testing.T) {
+	var in uploadTestFilesInput
+	mx := newUploadTestMux(t, newDefaultServer("test"), func(ctx *Context, input uploadTestFilesInput) (string, error) {
+		in = input
+		return input.Title, nil
+	})
+	w := serve(mx, newMultipartRequest(t, "/upload", "album",
+		uploadTestPart{"files", "a.txt", "text/plain", []byte("a")},
+		uploadTestPart{"photos", "p.png", "image/png", []byte("png")},
+		uploadTestPart{"files", "b.txt", "text/plain", []byte("bb")},
+	))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	if len(in.Files) != 2 || in.Files[0].Filename != "a.txt" || in.Files[1].Filename != "b.txt" || in.Files[1].Size != 2 {
+		t.Errorf("expected the files in order, got %+v", in.Files)
+	}
+	if len(in.Photos) != 1 || in.Photos[0].Filename != "p.png" || in.Photos[0].ContentType != "image/png" {
+		t.Errorf("expected the photo, got %+v", in.Photos)
+	}
+}
+
+type uploadTestTypesInput struct {
+	Title  string    `form:"title"`
+	Raw    []byte    `form:"raw"`
+	Reader io.Reader `form:"reader"`
+	File   FormFile  `form:"file"`
+}
+
+func TestMultipartFileTypes(t *testing.T) {
+	var raw, read []byte
+	var file FormFile
+	mx := newUploadTestMux(t, newDefaultServer("test"), func(ctx *Context, in uploadTestTypesInput) (string, error) {
+		var err error
+		raw, file = in.Raw, in.File
+		read, err = io.ReadAll(in.Reader)
+		return in.Title, err
+	})
+	w := serve(mx, newMultipartRequest(t, "/upload", "types",
+		uploadTestPart{"raw", "raw.bin", "application/octet-stream", []byte("raw")},
+		uploadTestPart{"reader", "reader.txt", "text/plain", []byte("read")},
+		uploadTestPart{"file", "file.csv", "text/csv", []byte("a,b\n1,2\n")},
+	))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	if string(raw) != "raw" || string(read) != "read" {
+		t.Errorf("expected the contents of the files, got %q and %q", raw, read)
+	}
+	if file.Filename != "file.csv" || file.ContentType != "text/csv" || file.Size != 8 || file.Header.Get("Content-Disposition") == "" {
+		t.Errorf("unexpected file metadata %+v", file)
+	}
+	f, err := file.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if content, _ := io.ReadAll(f); string(content) != "a,b\n1,2\n" {
+		t.Errorf("unexpected file content %q", content)
+	}
+}
+
+func TestMultipartTempFilesRemoved(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	var tmpFile string
+	var existed bool
+	mx := newUploadTestMux(t, newDefaultServer("test"), func(ctx *Context, in uploadTestInput) (string, error) {
+		// the large files are spooled to temp files
+		tmpFile = in.File.tmpFile
+		_, err := os.Stat(tmpFile)
+		existed = err == nil
+		return in.Title, nil
+	})
+	w := serve(mx, newUploadRequest(t, "large", bytes.Repeat([]byte{'x'}, maxMemoryFileBytes+1)))
+	if w.Code != http.StatusOK || tmpFile == "" || !existed {
+		t.Fatalf("expected the file spooled to a temp file, got %d %q", w.Code, tmpFile)
+	}
+	if _, err := os.Stat(tmpFile); !os.IsNotExist(err) {
+		t.Errorf("expected the temp file to be removed after the request, got %v", err)
+	}
+
+	// the temp files are removed as well if the request is rejected
+	svr := newDefaultServer("test")
+	svr.MaxUploadBytes = maxMemoryFileBytes + 1<<10
+	var called bool
+	mx = newUploadTestMux(t, svr, func(ctx *Context, in uploadTestFilesInput) (string, error) {
+		called = true
+		return "", nil
+	})
+	file := uploadTestPart{"files", "large.bin", "application/octet-stream", bytes.Repeat([]byte{'x'}, maxMemoryFileBytes+1)}
+	r := newMultipartRequest(t, "/upload", "large", file, file)
+	r.ContentLength = -1
+	if w = serve(mx, r); w.Code != http.StatusRequestEntityTooLarge || called {
+		t.Fatalf("expected 413, got %d", w.Code)
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) > 0 {
+		t.Errorf("expected the temp files of the rejected request to be removed, got %d", len(entries))
+	}
+}
@@ -5,12 +5,10 @@ import (
 	"mime"
 	"net/http"
 	"regexp"
-	"strconv"
 	"strings"
 
-	"github.com/wxy365/basal/ds/slices"
 	"github.com/wxy365/basal/errs"
-	"github.com/wxy365/basal/log"
+	"github.com/wxy365/basal/i18n"
 )
 
 var (
@@ -19,176 +17,49 @@ var (
 		http.MethodPut, http.MethodPost, http.MethodPatch,
 		http.MethodOptions, http.MethodTrace, http.MethodDelete,
 	}
-	expNamed       = regexp.MustCompile(`\{\w+}`)
-	expNamedRegexp = regexp.MustCompile(`\{\w+:~[\s\S]+}`)
-	expStatic      = regexp.MustCompile(`[\w.-]+`)
+	expParamName = regexp.MustCompile(`^\w+$`)
+	expCatchAll  = regexp.MustCompile(`^\{\w+\.\.\.}$`)
+	expStatic    = regexp.MustCompile(`^[\w.-]+$`)
 )
 
 type mux struct {
-	root *rootSection
+	router  *router
+	media   *mediaTypes
+	locales *localeNegotiator
+	// answers the OPTIONS requests of the paths without OPTIONS endpoints
+	optionsHandler func(ctx *Context) error
+	// the routes whose response is not negotiated with the Accept header, mapped to their fixed media type,
+	// eg. text/event-stream, which is empty for the WebSocket endpoints negotiating their messages only
+	fixedMedia map[epSig]string
+
+	maxUploadFileBytes int64
+	maxUploadBytes     int64
 }
 
-func newMux(handlers map[epSig]func(*Context)) *mux {
-	m := &mux{}
+func newMux(handlers map[epSig]func(*Context)) (*mux, error) {
 	if len(handlers) == 0 {
-		log.Panic("No handler specified when creating new http route mux")
-	}
-	m.root = &rootSection{
-		baseSection{
-			lvl:     0,
-			patn:    "/",
-			hdlrMap: make(map[string]func(*Context)),
-		},
+		return nil, errs.New("No handler specified when creating new http route mux")
 	}
-	// scan for endpoints with pattern "/"
+	m := &mux{router: newRouter(), optionsHandler: newOptionsHandler()}
 	for e, h := range handlers {
-		if e.pattern == "/" {
-			if _, exists := m.root.hdlrMap[e.method]; exists {
-				log.Panic("Duplicate endpoint definitions with the same uri pattern(/) and methods({0})", e.method)
-			}
-			m.root.hdlrMap[e.method] = h
-			delete(handlers, e)
-		}
-	}
-	for e, h := range handlers {
-		pattern := strings.TrimSpace(e.pattern)
-		pattern = strings.ReplaceAll(pattern, "//", "/")
-		parts := strings.Split(pattern, "/")
-		if len(parts) > 0 {
-			if parts[0] == "" {
-				parts = parts[1:]
-			}
-			addSection(m.root, 0, parts, e.method, h)
-		}
-	}
-	return m
-}
-
-func addSection(parent section, i int, parts []string, method string, h func(*Context)) {
-	if i >= len(parts) {
-		return
-	}
-	part := strings.TrimSpace(parts[i])
-	done := false
-	for _, chdn := range parent.children() {
-		if chdn.pattern() == part {
-			if i == len(parts)-1 {
-				if len(chdn.handlerMap()) > 0 {
-					if _, exists := chdn.handlerMap()[method]; exists {
-						log.Panic("Duplicate endpoint definitions with the same uri pattern(/{0}) and method({1}})", strings.Join(parts, "/"), method)
-					}
-				}
-				chdn.addHandler(method, h)
-				return
-			} else {
-				addSection(chdn, i+1, parts, method, h)
-				done = true
-				break
-			}
-		}
-	}
-	if !done {
-		s := newSection(parent, i, parts, method, h)
-		addSection(s, i+1, parts, method, h)
-	}
-}
-
-func newSection(parent section, i int, parts []string, method string, h func(ctx *Context)) section {
-	var s section
-	isEndPart := i == len(parts)-1
-	pattern := parts[i]
-	base := baseSection{
-		lvl:  parent.level() + 1,
-		prnt: parent,
-		patn: pattern,
-	}
-	if pattern == "*" {
-		s = &matchAllSection{base}
-	} else if strings.HasPrefix(pattern, "~") {
-		reg, err := regexp.Compile(pattern[1:])
-		if err != nil {
-			log.PanicErr(err)
-		}
-		s = &regexpSection{
-			baseSection: base,
-			exp:         reg,
-		}
-	} else if pattern == "%s" {
-		s = &formatSection{
-			baseSection: base,
-			validator: func(s string) bool {
-				return s != ""
-			},
-		}
-	} else if pattern == "%d" {
-		s = &formatSection{
-			baseSection: base,
-			validator: func(s string) bool {
-				_, e := strconv.ParseInt(s, 10, 64)
-				return e == nil
-			},
-		}
-	} else if pattern == "" {
-		s = &emptyFinalSection{base}
-	} else if expNamedRegexp.MatchString(pattern) {
-		expr := pattern[1 : len(pattern)-1]
-		t := strings.Split(expr, ":")
-		rexp, err := regexp.Compile(t[1][1:])
-		if err != nil {
-			log.PanicErr(err)
-		}
-		s = &namedRegexpSection{
-			baseSection: base,
-			name:        t[0],
-			exp:         rexp,
-		}
-	} else if expNamed.MatchString(pattern) {
-		s = &namedSection{
-			baseSection: base,
-			name:        pattern[1 : len(pattern)-1],
+		if err := m.router.add(e.pattern, e.method, h); err != nil {
+			return nil, err
 		}
-	} else if expStatic.MatchString(pattern) {
-		s = &staticSection{
-			base,
-		}
-	}
-
-	if isEndPart {
-		s.addHandler(method, h)
 	}
-	parent.addChild(s)
-	return s
+	return m, nil
 }
 
 func (m *mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	acceptType, _, err := mime.ParseMediaType(r.Header.Get("Accept"))
-	if err != nil {
-		acceptType = MimeJson
-	}
-	if acceptType == "*/*" {
-		acceptType = MimeJson
-	}
-	serializer := serializers[acceptType]
-	serialize := func(er error) {
-		err = serializer(er, w)
-		// this should never happen
-		if err != nil {
-			log.ErrorErrF("Error in serializing error message", err)
-		}
-	}
-
-	r = r.WithContext(context.WithValue(r.Context(), ctxKeySerializer, serializer))
-
-	r = r.WithContext(context.WithValue(r.Context(), ctxKeyAcceptType, acceptType))
-
-	contentType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
-	if err != nil {
-		contentType = MimeJson
-	}
-	deserializer := deserializers[contentType]
-	r = r.WithContext(context.WithValue(r.Context(), ctxKeyDeserializer, deserializer))
-	if len(params) > 0 {
-		r = r.WithContext(context.WithValue(r.Context(), ctxKeyContentTypeParams, params))
+	// the representation of every response varies with the Accept header, and the messages with the locale
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Accept-Language")
+	locale := m.locales.negotiate(r)
+	r = r.WithContext(i18n.WithLocale(context.WithValue(r.Context(), ctxKeyLocale, locale), locale))
+	accept := r.Header.Get("Accept")
+	acceptType, serializer, acceptable := m.media.negotiate(accept)
+	if !acceptable {
+		// the problems are rendered in JSON if none of the media types accepted is supported
+		acceptType, serializer = MimeJson, m.jsonSerializer()
 	}
 
 	ctx := &Context{
@@ -196,304 +67,131 @@ func (m *mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Writer:  w,
 	}
 
-	if m.root == nil {
-		serialize(errs.New("No endpoint defined").WithStatus(http.StatusNotFound))
-		return
-	}
-	path := strings.ReplaceAll(r.URL.Path, "//", "/")
-	rootFm, _, _ := m.root.finalMatch(r.Method, "")
-	if path == "" || path == "/" {
-		if rootFm {
-			m.root.handler(r.Method)(ctx)
-		} else {
-			serialize(errs.New("Resource not found").WithStatus(http.StatusNotFound))
-			return
+	pathParams := acquirePathParams()
+	defer releasePathParams(pathParams)
+	method := r.Method
+	n, ok := m.router.route(method, r.URL.Path, pathParams)
+	if !ok && method == http.MethodHead {
+		// HEAD is served by the GET endpoint without the body
+		method = http.MethodGet
+		if n, ok = m.router.route(method, r.URL.Path, pathParams); ok {
+			ctx.Writer = headResponseWriter{w}
 		}
-		return
-	}
-
-	theOne := new(section)
-	pathParams := make(map[section][2]string)
-	if rootFm {
-		*theOne = m.root
 	}
-	if len(m.root.chdn) > 0 {
-		parts := strings.Split(path, "/")
-		if parts[0] == "" {
-			parts = parts[1:]
+	if !ok {
+		allowed := m.router.allowed(r.URL.Path)
+		if len(allowed) == 0 {
+			writeProblem(w, r, errs.New("Resource not found").WithStatus(http.StatusNotFound), serializer, acceptType)
+			return
 		}
-		for _, s := range m.root.children() {
-			match(s, 0, parts, r.Method, pathParams, theOne)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		if r.Method == http.MethodOptions {
+			m.options(ctx, allowed)
+			return
 		}
-	}
-	if *theOne == nil {
-		serialize(errs.New("Resource not found").WithStatus(http.StatusNotFound))
+		writeProblem(w, r, errs.New("Method [{0}] not allowed, allowed methods: {1}", r.Method, strings.Join(allowed, ", ")).
+			WithStatus(http.StatusMethodNotAllowed), serializer, acceptType)
 		return
 	}
-	if len(pathParams) > 0 {
-		pm := make(map[string]string)
-		for s := *theOne; s != nil; {
-			if param, exists := pathParams[s]; exists {
-				pm[param[0]] = param[1]
-			}
-			s = s.parent()
-		}
-		r = r.WithContext(context.WithValue(r.Context(), ctxKeyPathParams, pm))
-	}
 
-	(*theOne).handler(r.Method)(ctx)
-}
-
-func match(s section, idx int, uriParts []string, method string, pathParams map[section][2]string, theOne *section) {
-	part := uriParts[idx]
-	if ok, k, v := s.finalMatch(method, part); ok {
-		if *theOne == nil || s.level() > (*theOne).level() || s.level() == (*theOne).level() && s.weight() > (*theOne).weight() {
-			*theOne = s
-			if len(k) > 0 {
-				pathParams[s] = [2]string{k, v}
+	fixed, isFixed := m.fixedMedia[epSig{method: method, pattern: n.pattern}]
+	if isFixed {
+		if fixed != "" {
+			if _, ok := negotiateContentType(accept, []string{fixed}); !ok {
+				writeProblem(w, r, errs.New("The media type of the response is [{0}], which is not accepted", fixed).
+					WithStatus(http.StatusNotAcceptable), serializer, acceptType)
+				return
 			}
+			// the data carried by the fixed media type, eg. the events, is serialized as JSON
+			acceptType, serializer = MimeJson, m.jsonSerializer()
 		}
+	} else if !acceptable {
+		writeProblem(w, r, errs.New("None of the media types accepted is supported, supported media types: {0}", strings.Join(m.media.serializableTypes(), ", ")).
+			WithStatus(http.StatusNotAcceptable), serializer, acceptType)
+		return
 	}
-	if ok, k, v := s.middleMatch(part); ok {
-		if len(k) > 0 {
-			pathParams[s] = [2]string{k, v}
-		}
-		for _, chdn := range s.children() {
-			match(chdn, idx+1, uriParts, method, pathParams, theOne)
-		}
-	}
-}
-
-type section interface {
-	finalMatch(method, uriPart string) (bool, string, string)
-	middleMatch(uriPart string) (bool, string, string)
-	level() int
-	weight() int
-	parent() section
-	children() []section
-	handler(method string) func(ctx *Context)
-	handlerMap() map[string]func(ctx *Context)
-	pattern() string
-	addHandler(method string, h func(ctx *Context))
-	addChild(section)
-}
-
-type baseSection struct {
-	lvl     int
-	prnt    section                       // parent section
-	chdn    []section                     // children sections. a tail section has no children
-	hdlrMap map[string]func(ctx *Context) // http endpoint handler, only tail section has handler
-	patn    string
-}
-
-func (b *baseSection) finalMatch(method, uriPart string) (bool, string, string) {
-	if len(b.hdlrMap) == 0 || b.hdlrMap[method] == nil {
-		return false, "", ""
-	}
-	return true, "", ""
-}
-
-func (b *baseSection) middleMatch(uriPart string) (bool, string, string) {
-	if len(b.chdn) == 0 {
-		return false, "", ""
-	}
-	return true, "", ""
-}
-
-func (b *baseSection) level() int {
-	return b.lvl
-}
-
-func (b *baseSection) parent() section {
-	return b.prnt
-}
-
-func (b *baseSection) children() []section {
-	return b.chdn
-}
-
-func (b *baseSection) handler(method string) func(ctx *Context) {
-	return b.hdlrMap[method]
-}
 
-func (b *baseSection) weight() int {
-	return 0
-}
-
-func (b *baseSection) pattern() string {
-	return b.patn
-}
+	r = r.WithContext(context.WithValue(r.Context(), ctxKeySerializer, serializer))
 
-func (b *baseSection) handlerMap() map[string]func(ctx *Context) {
-	return b.hdlrMap
-}
+	r = r.WithContext(context.WithValue(r.Context(), ctxKeyAcceptType, acceptType))
 
-func (b *baseSection) addHandler(method string, h func(ctx *Context)) {
-	if len(b.hdlrMap) == 0 {
-		b.hdlrMap = make(map[string]func(ctx *Context))
-	}
-	method = strings.ToUpper(method)
-	if slices.Lookup(allowedMethods, method, func(left, right string) bool {
-		return left == right
-	}) == -1 {
-		log.Panic("Http method [{0}] not allowed", method)
+	contentType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		contentType = MimeJson
 	}
-	b.hdlrMap[method] = h
-}
-
-func (b *baseSection) addChild(child section) {
-	b.chdn = append(b.chdn, child)
-}
-
-type staticSection struct {
-	baseSection
-}
-
-func (s *staticSection) finalMatch(method, uriPart string) (bool, string, string) {
-	if len(s.hdlrMap) == 0 || s.hdlrMap[method] == nil {
-		return false, "", ""
+	deserializer := m.media.deserializer(contentType)
+	if deserializer == nil && r.Header.Get("Content-Type") != "" && r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		writeProblem(w, r, errs.New("Media type [{0}] of the request body is not supported", contentType).
+			WithStatus(http.StatusUnsupportedMediaType), serializer, acceptType)
+		return
 	}
-	return uriPart == s.patn, "", ""
-}
-
-func (s *staticSection) middleMatch(uriPart string) (bool, string, string) {
-	if len(s.chdn) == 0 {
-		return false, "", ""
+	if deserializer == nil && isFixed {
+		// the messages of the WebSocket endpoints are decoded as JSON if the content type is not supported
+		deserializer = m.jsonDeserializer()
 	}
-	return uriPart == s.patn, "", ""
-}
-
-// staticSection has the maximum weight: 64
-func (s *staticSection) weight() int {
-	return 64
-}
-
-type regexpSection struct {
-	baseSection
-	exp *regexp.Regexp
-}
-
-func (r *regexpSection) finalMatch(method, uriPart string) (bool, string, string) {
-	if len(r.hdlrMap) == 0 || r.hdlrMap[method] == nil {
-		return false, "", ""
-	}
-	return r.exp.MatchString(uriPart), "", ""
-}
-
-func (r *regexpSection) middleMatch(uriPart string) (bool, string, string) {
-	if len(r.chdn) == 0 {
-		return false, "", ""
+	r = r.WithContext(context.WithValue(r.Context(), ctxKeyDeserializer, deserializer))
+	if len(params) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyContentTypeParams, params))
 	}
-	return r.exp.MatchString(uriPart), "", ""
-}
-
-func (r *regexpSection) weight() int {
-	return 48
-}
-
-type formatSection struct {
-	baseSection
-	validator func(string) bool
-}
-
-func (f *formatSection) finalMatch(method, uriPart string) (bool, string, string) {
-	if len(f.hdlrMap) == 0 || f.hdlrMap[method] == nil {
-		return false, "", ""
+	if contentType == MimeMultipartForm {
+		upload := newUploadState(m.maxUploadFileBytes, m.maxUploadBytes)
+		defer upload.cleanup()
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyUpload, upload))
 	}
-	return f.validator(uriPart), "", ""
-}
-
-func (f *formatSection) middleMatch(uriPart string) (bool, string, string) {
-	if len(f.chdn) == 0 {
-		return false, "", ""
+	if len(pathParams.list) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyPathParams, pathParams))
 	}
-	return f.validator(uriPart), "", ""
-}
+	ctx.Request = r
 
-func (f *formatSection) weight() int {
-	return 56
+	n.handlers[method](ctx)
 }
 
-type namedSection struct {
-	baseSection
-	name string
-}
-
-func (n *namedSection) finalMatch(method, uriPart string) (bool, string, string) {
-	if len(n.hdlrMap) == 0 || n.hdlrMap[method] == nil {
-		return false, "", ""
+// jsonSerializer returns the JSON serializer of the server, or the global one if not set
+func (m *mux) jsonSerializer() Serializer {
+	if s := m.media.serializer(MimeJson); s != nil {
+		return s
 	}
-	return true, n.name, uriPart
+	return SerializeJson
 }
 
-func (n *namedSection) middleMatch(uriPart string) (bool, string, string) {
-	if len(n.chdn) == 0 {
-		return false, "", ""
+// jsonDeserializer returns the JSON deserializer of the server, or the global one if not set
+func (m *mux) jsonDeserializer() Deserializer {
+	if d := m.media.deserializer(MimeJson); d != nil {
+		return d
 	}
-	return true, n.name, uriPart
+	return DeserializeJson
 }
 
-func (n *namedSection) weight() int {
-	return 8
-}
-
-type namedRegexpSection struct {
-	baseSection
-	name string
-	exp  *regexp.Regexp
-}
-
-func (n *namedRegexpSection) finalMatch(method, uriPart string) (bool, string, string) {
-	if len(n.hdlrMap) == 0 || n.hdlrMap[method] == nil {
-		return false, "", ""
+// options answers the OPTIONS request of a path without OPTIONS endpoint. The Allow header is already set, and the
+// cors interceptor takes over the preflight requests, which allow the methods of the path unless configured otherwise.
+func (m *mux) options(ctx *Context, allowed []string) {
+	if ctx.Request.Header.Get("Origin") != "" && ctx.Request.Header.Get("Access-Control-Request-Method") != "" {
+		ctx.Writer.Header().Set("Access-Control-Allow-Methods", strings.Join(allowed, ","))
 	}
-	return n.exp.MatchString(uriPart), n.name, uriPart
+	_ = m.optionsHandler(ctx)
 }
 
-func (n *namedRegexpSection) middleMatch(uriPart string) (bool, string, string) {
-	if len(n.chdn) == 0 {
-		return false, "", ""
+func newOptionsHandler() func(ctx *Context) error {
+	h := func(ctx *Context) error {
+		ctx.Writer.WriteHeader(http.StatusNoContent)
+		return nil
 	}
-	return n.exp.MatchString(uriPart), n.name, uriPart
-}
-
-func (n *namedRegexpSection) weight() int {
-	return 52
-}
-
-// /*
-type matchAllSection struct {
-	baseSection
-}
-
-func (m *matchAllSection) finalMatch(method, uriPart string) (bool, string, string) {
-	if len(m.hdlrMap) == 0 || m.hdlrMap[method] == nil {
-		return false, "", ""
-	}
-	return true, "", ""
-}
-
-func (m *matchAllSection) middleMatch(uriPart string) (bool, string, string) {
-	if len(m.chdn) == 0 {
-		return false, "", ""
+	if cors := newCorsInterceptor(); cors != nil {
+		h = cors(h)
 	}
-	return true, "", ""
-}
-
-func (m *matchAllSection) weight() int {
-	return 4
+	return recoverInterceptor(h)
 }
 
-// /
-type rootSection struct {
-	baseSection
+// headResponseWriter discards the body written by the GET endpoint serving a HEAD request
+type headResponseWriter struct {
+	http.ResponseWriter
 }
 
-// ""
-type emptyFinalSection struct {
-	baseSection
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
 }
 
-func (e *emptyFinalSection) middleMatch(uriPart string) (bool, string, string) {
-	return false, "", ""
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
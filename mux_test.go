@@ -0,0 +1,314 @@
+package sprout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func noopHandler(*Context) {}
+
+// newTestMux mounts the endpoints on a default server and builds its mux
+func newTestMux(t testing.TB, eps ...Mountable) *mux {
+	t.Helper()
+	return newServerTestMux(t, newDefaultServer("test"), eps...)
+}
+
+// newServerTestMux mounts the endpoints on the server and builds its mux
+func newServerTestMux(t testing.TB, svr *Server, eps ...Mountable) *mux {
+	t.Helper()
+	mountTestEndpoints(t, svr, eps...)
+	mx, err := svr.buildMux()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mx
+}
+
+// mountTestEndpoints mounts the endpoints on the server
+func mountTestEndpoints(t testing.TB, svr *Server, eps ...Mountable) {
+	t.Helper()
+	for _, ep := range eps {
+		if err := ep.appendToServer(svr, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func serve(mx *mux, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	mx.ServeHTTP(w, r)
+	return w
+}
+
+func TestRouterRoute(t *testing.T) {
+	rt := newRouter()
+	for _, ep := range []epSig{
+		{http.MethodGet, "/"},
+		{http.MethodGet, "/users"},
+		{http.MethodGet, "/users/"},
+		{http.MethodGet, "/users/me"},
+		{http.MethodGet, "/users/%d"},
+		{http.MethodGet, "/users/{name}"},
+		{http.MethodGet, "/users/{id:~^u\\d+$}/orders"},
+		{http.MethodGet, "/users/{name}/orders/{order}"},
+		{http.MethodGet, "/files/*/raw"},
+		{http.MethodPost, "/users"},
+	} {
+		if err := rt.add(ep.pattern, ep.method, noopHandler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rt.add("/users/%d", http.MethodGet, noopHandler); err == nil {
+		t.Fatal("expected the duplicate endpoint to be rejected")
+	}
+
+	for _, c := range []struct {
+		method, path, pattern string
+		params                []pathParam
+	}{
+		{http.MethodGet, "/", "/", nil},
+		{http.MethodGet, "/users", "/users", nil},
+		{http.MethodPost, "//users", "/users", nil},
+		{http.MethodPost, "///users", "/users", nil},
+		{http.MethodGet, "/users///me", "/users/me", nil},
+		{http.MethodGet, "/users////bob//orders///9", "/users/{name}/orders/{order}", []pathParam{{"name", "bob"}, {"order", "9"}}},
+		{http.MethodGet, "/users/", "/users/", nil},
+		{http.MethodGet, "/users/me", "/users/me", nil},
+		{http.MethodGet, "/users/42", "/users/%d", nil},
+		{http.MethodGet, "/users/bob", "/users/{name}", []pathParam{{"name", "bob"}}},
+		{http.MethodGet, "/users/u7/orders", "/users/{id:~^u\\d+$}/orders", []pathParam{{"id", "u7"}}},
+		// backtracks from the regexp segment to the named one
+		{http.MethodGet, "/users/u7/orders/9", "/users/{name}/orders/{order}", []pathParam{{"name", "u7"}, {"order", "9"}}},
+		{http.MethodGet, "/files/a.txt/raw", "/files/*/raw", nil},
+		{http.MethodGet, "/users/bob/orders/9/x", "", nil},
+		{http.MethodGet, "/users/me/orders", "", nil},
+		{http.MethodDelete, "/users", "", nil},
+		{http.MethodGet, "/files/a.txt", "", nil},
+	} {
+		params := acquirePathParams()
+		n, ok := rt.route(c.method, c.path, params)
+		if c.pattern == "" {
+			if ok {
+				t.Errorf("%s %s: expected no route, got %s", c.method, c.path, n.pattern)
+			}
+		} else if !ok || n.pattern != c.pattern {
+			t.Errorf("%s %s: expected %s, got %v", c.method, c.path, c.pattern, n)
+		} else if len(params.list) != len(c.params) {
+			t.Errorf("%s %s: expected params %v, got %v", c.method, c.path, c.params, params.list)
+		} else {
+			for i, p := range c.params {
+				if params.list[i] != p {
+					t.Errorf("%s %s: expected params %v, got %v", c.method, c.path, c.params, params.list)
+					break
+				}
+			}
+		}
+		releasePathParams(params)
+	}
+}
+
+func TestRouterWildcards(t *testing.T) {
+	rt := newRouter()
+	for _, pattern := range []string{
+		"/files/{path...}",
+		"/files/readme",
+		"/static/**",
+		"/docs/",
+		"/docs/{path...}",
+		"/v{version:~\\d+}/users",
+		"/api/{name}.{ext}",
+		"/api/{name}.tar.gz",
+		"/api/{name}",
+		"/codes/{code:~^\\d{3}$}.json",
+	} {
+		if err := rt.add(pattern, http.MethodGet, noopHandler); err != nil {
+			t.Fatal(pattern, err)
+		}
+	}
+	for _, pattern := range []string{"/files/{path...}/raw", "/api/{a}{b}", "/api/{a:~[}", "/api/{a"} {
+		if err := rt.add(pattern, http.MethodPost, noopHandler); err == nil {
+			t.Errorf("expected the invalid pattern %s to be rejected", pattern)
+		}
+	}
+
+	for _, c := range []struct {
+		path, pattern string
+		params        string
+	}{
+		{"/files/readme", "/files/readme", ""},
+		{"/files/a/b/c.txt", "/files/{path...}", "path=a/b/c.txt"},
+		// the rest of the path may be empty
+		{"/files/", "/files/{path...}", "path="},
+		{"/files", "", ""},
+		{"/static/css/app.css", "/static/**", "**=css/app.css"},
+		{"/static/", "/static/**", "**="},
+		// the static pattern takes precedence over the empty rest
+		{"/docs/", "/docs/", ""},
+		{"/docs/a/", "/docs/{path...}", "path=a/"},
+		{"/v2/users", "/v{version:~\\d+}/users", "version=2"},
+		{"/vx/users", "", ""},
+		{"/api/backup.tar.gz", "/api/{name}.tar.gz", "name=backup"},
+		{"/api/archive.v1.zip", "/api/{name}.{ext}", "name=archive.v1,ext=zip"},
+		{"/api/readme", "/api/{name}", "name=readme"},
+		{"/codes/404.json", "/codes/{code:~^\\d{3}$}.json", "code=404"},
+	} {
+		params := acquirePathParams()
+		n, ok := rt.route(http.MethodGet, c.path, params)
+		var captured []string
+		for _, p := range params.list {
+			captured = append(captured, p.name+"="+p.value)
+		}
+		if c.pattern == "" {
+			if ok {
+				t.Errorf("%s: expected no route, got %s", c.path, n.pattern)
+			}
+		} else if !ok || n.pattern != c.pattern || strings.Join(captured, ",") != c.params {
+			t.Errorf("%s: expected %s with %s, got %v with %v", c.path, c.pattern, c.params, n, captured)
+		}
+		releasePathParams(params)
+	}
+}
+
+type catchAllTestInput struct {
+	Path string `path:"path"`
+}
+
+type requiredCatchAllTestInput struct {
+	Path string `path:"path" validate:"required"`
+}
+
+func TestCatchAllBinding(t *testing.T) {
+	handler := func(ctx *Context, in catchAllTestInput) (string, error) { return "[" + in.Path + "]", nil }
+	mx := newTestMux(t,
+		&Endpoint[catchAllTestInput, string]{
+			Name:    "files",
+			Pattern: "/files/{path...}",
+			Methods: []string{http.MethodGet},
+			Handler: handler,
+		},
+		&Endpoint[requiredCatchAllTestInput, string]{
+			Name:    "objects",
+			Pattern: "/objects/{path...}",
+			Methods: []string{http.MethodGet},
+			Handler: func(ctx *Context, in requiredCatchAllTestInput) (string, error) { return in.Path, nil },
+		},
+	)
+	for _, c := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/files/a/b.txt", http.StatusOK, `"[a/b.txt]"`},
+		{"/files/", http.StatusOK, `"[]"`},
+		{"/files", http.StatusNotFound, ""},
+		{"/objects/a", http.StatusOK, `"a"`},
+		// the empty rest is rejected by the validation
+		{"/objects/", http.StatusBadRequest, ""},
+	} {
+		w := serve(mx, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if w.Code != c.status || c.body != "" && strings.TrimSpace(w.Body.String()) != c.body {
+			t.Errorf("%s: expected %d %s, got %d %s", c.path, c.status, c.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouterAllowed(t *testing.T) {
+	rt := newRouter()
+	for _, ep := range []epSig{
+		{http.MethodGet, "/users/{name}"},
+		{http.MethodPut, "/users/{name}"},
+		{http.MethodDelete, "/users/me"},
+	} {
+		if err := rt.add(ep.pattern, ep.method, noopHandler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, expected := range map[string]string{
+		"/users/me":  "GET, HEAD, PUT, OPTIONS, DELETE",
+		"/users/bob": "GET, HEAD, PUT, OPTIONS",
+		"/users":     "",
+	} {
+		if allowed := strings.Join(rt.allowed(path), ", "); allowed != expected {
+			t.Errorf("%s: expected %q, got %q", path, expected, allowed)
+		}
+	}
+}
+
+func TestExpandPattern(t *testing.T) {
+	for _, c := range []struct {
+		pattern  string
+		params   map[string]string
+		expected string
+	}{
+		{"/users/{id:~^\\d+$}", map[string]string{"id": "12"}, "/users/12"},
+		{"/users/{id:~^\\d+$}", map[string]string{"id": "ab"}, ""},
+		{"/users/{name}", map[string]string{}, ""},
+		{"/files/{path...}", map[string]string{"path": "a b/c.txt"}, "/files/a%20b/c.txt"},
+		{"/v{version:~\\d+}/{name}.{ext}", map[string]string{"version": "2", "name": "x", "ext": "json"}, "/v2/x.json"},
+		{"/v{version:~\\d+}/users", map[string]string{"version": "x"}, ""},
+	} {
+		url, err := ExpandPattern(c.pattern, c.params)
+		if c.expected == "" && err == nil {
+			t.Errorf("%s: expected an error, got %s", c.pattern, url)
+		} else if c.expected != "" && url != c.expected {
+			t.Errorf("%s: expected %s, got %s, %v", c.pattern, c.expected, url, err)
+		}
+	}
+}
+
+// benchRouter mounts 400 endpoints, 10 per resource
+func benchRouter(b *testing.B) *router {
+	rt := newRouter()
+	for i := 0; i < 40; i++ {
+		res := "/api/v1/resource" + strconv.Itoa(i)
+		for _, ep := range []epSig{
+			{http.MethodGet, res},
+			{http.MethodPost, res},
+			{http.MethodGet, res + "/search"},
+			{http.MethodGet, res + "/{id}"},
+			{http.MethodPut, res + "/{id}"},
+			{http.MethodDelete, res + "/{id}"},
+			{http.MethodGet, res + "/{id}/items"},
+			{http.MethodPost, res + "/{id}/items"},
+			{http.MethodGet, res + "/{id}/items/%d"},
+			{http.MethodGet, res + "/{id}/tags/{tag:~^[a-z]+$}"},
+		} {
+			if err := rt.add(ep.pattern, ep.method, noopHandler); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return rt
+}
+
+func benchmarkRoute(b *testing.B, method, path string) {
+	rt := benchRouter(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params := acquirePathParams()
+		if _, ok := rt.route(method, path, params); !ok {
+			b.Fatalf("no route for %s %s", method, path)
+		}
+		releasePathParams(params)
+	}
+}
+
+func BenchmarkRouteStatic(b *testing.B) {
+	benchmarkRoute(b, http.MethodGet, "/api/v1/resource39/search")
+}
+
+func BenchmarkRouteParam(b *testing.B) {
+	benchmarkRoute(b, http.MethodDelete, "/api/v1/resource39/12345")
+}
+
+func BenchmarkRouteDeep(b *testing.B) {
+	benchmarkRoute(b, http.MethodGet, "/api/v1/resource39/12345/items/6")
+}
+
+func BenchmarkRouteRegexp(b *testing.B) {
+	benchmarkRoute(b, http.MethodGet, "/api/v1/resource39/12345/tags/golang")
+}
@@ -0,0 +1,713 @@
+package sprout
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wxy365/basal/errs"
+)
+
+const openAPIVersion = "3.1.0"
+
+// OpenAPI is the root object of an OpenAPI 3.1 document
+type OpenAPI struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       OpenAPIInfo          `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem maps the lower-cased http methods to the operations of a path
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationId string                      `json:"operationId,omitempty"`
+	Parameters  []*Parameter                `json:"parameters,omitempty"`
+	RequestBody *RequestBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type OpenAPIResponse struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema is a subset of the JSON Schema 2020-12 used by OpenAPI 3.1
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	UniqueItems          bool               `json:"uniqueItems,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+}
+
+// OpenAPI builds the OpenAPI 3.1 document of the endpoints mounted on the server
+func (s *Server) OpenAPI() *OpenAPI {
+	version := s.APIVersion
+	if version == "" {
+		version = "0.0.0"
+	}
+	media, err := newMediaTypes(s.Serializers, s.Deserializers)
+	if err != nil {
+		// the invalid media types of the server are reported when it starts, document the registered ones meanwhile
+		media, _ = newMediaTypes(nil, nil)
+	}
+	b := &schemaBuilder{
+		media:   media,
+		names:   make(map[reflect.Type]string),
+		schemas: make(map[string]*Schema),
+	}
+	doc := &OpenAPI{
+		OpenAPI: openAPIVersion,
+		Info: OpenAPIInfo{
+			Title:   s.Name,
+			Version: version,
+		},
+		Paths: make(map[string]*PathItem),
+	}
+	for _, ep := range s.endpoints {
+		apiPath, pathParams := openAPIPath(ep.pattern)
+		item := doc.Paths[apiPath]
+		if item == nil {
+			item = &PathItem{}
+			doc.Paths[apiPath] = item
+		}
+		for _, mth := range ep.methods {
+			op := b.operation(ep, mth, pathParams)
+			if len(ep.methods) > 1 {
+				op.OperationId = ep.name + "_" + mth
+			}
+			(*item)[strings.ToLower(mth)] = op
+		}
+	}
+	if len(b.schemas) > 0 {
+		doc.Components = &Components{Schemas: b.schemas}
+	}
+	return doc
+}
+
+var (
+	typeTime    = reflect.TypeOf(time.Time{})
+	typeBytes   = reflect.TypeOf([]byte{})
+	typeProblem = reflect.TypeOf(Problem{})
+	typeRefId   = regexp.MustCompile(`[^\w.-]`)
+)
+
+type schemaBuilder struct {
+	media   *mediaTypes
+	names   map[reflect.Type]string
+	schemas map[string]*Schema
+}
+
+func (b *schemaBuilder) operation(ep *refinedEndpoint, method string, pathParams []*Parameter) *Operation {
+	op := &Operation{
+		OperationId: ep.name,
+		Responses:   make(map[string]*OpenAPIResponse),
+	}
+	params := make(map[string]*Parameter)
+	for _, p := range pathParams {
+		params[p.Name] = p
+		op.Parameters = append(op.Parameters, p)
+	}
+
+	body := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	if ep.inputType != nil {
+		b.inputFields(ep.inputType, op, params, body)
+	}
+	if ep.inputType != nil && methodHasBody(method) {
+		op.RequestBody = b.requestBody(ep.inputType, body)
+	}
+
+	if ep.websocket {
+		op.Responses[strconv.Itoa(http.StatusSwitchingProtocols)] = &OpenAPIResponse{Description: "Switching Protocols"}
+	} else {
+		b.successResponses(ep, op)
+	}
+	op.Responses["default"] = &OpenAPIResponse{
+		Description: "Error",
+		Content: map[string]*MediaType{
+			MimeProblemJson: {Schema: b.schema(typeProblem)},
+		},
+	}
+	return op
+}
+
+// successResponses documents the status declared by the output envelope, eg. status:"201", any 2xx status if the
+// output sets it at runtime, eg. Response[T], or 200 and 204 otherwise
+func (b *schemaBuilder) successResponses(ep *refinedEndpoint, op *Operation) {
+	var content map[string]*MediaType
+	if ep.outputType != nil {
+		outputMime := ep.outputMime
+		if outputMime == "" {
+			outputMime = MimeJson
+		}
+		content = map[string]*MediaType{
+			outputMime: {Schema: b.schema(ep.outputType)},
+		}
+	}
+	env := ep.envelope
+	switch {
+	case env != nil && env.declaredStatus > 0:
+		resp := &OpenAPIResponse{Description: http.StatusText(env.declaredStatus)}
+		if bodyAllowed(env.declaredStatus) {
+			resp.Content = content
+		}
+		op.Responses[strconv.Itoa(env.declaredStatus)] = resp
+	case env != nil && env.status >= 0:
+		op.Responses["2XX"] = &OpenAPIResponse{Description: "Success", Content: content}
+	default:
+		if content != nil {
+			op.Responses[strconv.Itoa(http.StatusOK)] = &OpenAPIResponse{Description: "OK", Content: content}
+		}
+		op.Responses[strconv.Itoa(http.StatusNoContent)] = &OpenAPIResponse{Description: "No Content"}
+	}
+}
+
+// requestBody documents the body of the input in the media types the server deserializes, nil if the input has
+// no body fields. The inputs uploading files are documented as multipart forms only.
+func (b *schemaBuilder) requestBody(t reflect.Type, body *Schema) *RequestBody {
+	uploads := false
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := formFieldName(t.Field(i)); ok && isUploadType(t.Field(i).Type) {
+			uploads = true
+			break
+		}
+	}
+	req := &RequestBody{Content: make(map[string]*MediaType)}
+	for _, mediaType := range b.media.deserializableTypes() {
+		schema := body
+		switch {
+		case mediaType == MimeMultipartForm:
+			schema = b.formBody(t, true)
+		case uploads:
+			continue
+		case mediaType == MimeUrlencodedForm:
+			schema = b.formBody(t, false)
+		}
+		if len(schema.Properties) == 0 {
+			continue
+		}
+		req.Content[mediaType] = &MediaType{Schema: schema}
+		req.Required = req.Required || len(schema.Required) > 0
+	}
+	if len(req.Content) == 0 {
+		return nil
+	}
+	return req
+}
+
+// formBody builds the schema of the input fields bound from a form, the files are binary strings of multipart forms
+func (b *schemaBuilder) formBody(t reflect.Type, multipart bool) *Schema {
+	obj := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := formFieldName(f)
+		if !ok {
+			continue
+		}
+		var schema *Schema
+		switch {
+		case multipart && (isUploadType(f.Type) || f.Type == typeBytes):
+			schema = &Schema{Type: "string", Format: "binary"}
+			if ft := derefType(f.Type); ft.Kind() == reflect.Slice && ft != typeBytes {
+				schema = &Schema{Type: "array", Items: schema}
+			}
+		case isUploadType(f.Type):
+			continue
+		default:
+			schema = b.schema(f.Type)
+			if schema.Ref == "" {
+				applyValidateTag(schema, f.Tag.Get("validate"), derefType(f.Type))
+			}
+		}
+		if hasValidateRule(f.Tag.Get("validate"), "required") {
+			obj.Required = append(obj.Required, name)
+		}
+		obj.Properties[name] = schema
+	}
+	return obj
+}
+
+// inputFields collects the parameters and the body properties declared by the fields of the input type
+func (b *schemaBuilder) inputFields(t reflect.Type, op *Operation, params map[string]*Parameter, body *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		validateTag := f.Tag.Get("validate")
+		var in, name string
+		for _, loc := range []string{"path", "query", "header", "cookie"} {
+			if key, ok := f.Tag.Lookup(loc); ok {
+				in, name = loc, key
+				break
+			}
+		}
+		if in == "" {
+			if !isUploadType(f.Type) {
+				b.property(f, body)
+			}
+			continue
+		}
+		schema := b.schema(f.Type)
+		applyValidateTag(schema, validateTag, derefType(f.Type))
+		if in == "path" {
+			// only the parameters declared by the pattern are path parameters, refine them with the field type
+			if p, exists := params[name]; exists && p.In == "path" {
+				if p.Schema != nil && p.Schema.Pattern != "" && schema.Type == "string" {
+					schema.Pattern = p.Schema.Pattern
+				}
+				p.Schema = schema
+			}
+			continue
+		}
+		p := &Parameter{
+			Name:     name,
+			In:       in,
+			Required: hasValidateRule(validateTag, "required"),
+			Schema:   schema,
+		}
+		params[name] = p
+		op.Parameters = append(op.Parameters, p)
+	}
+}
+
+// property adds the field as a property of the object schema
+func (b *schemaBuilder) property(f reflect.StructField, obj *Schema) {
+	if !f.IsExported() {
+		return
+	}
+	name, skip := jsonFieldName(f)
+	if skip {
+		return
+	}
+	if f.Anonymous && name == "" {
+		ft := derefType(f.Type)
+		if ft.Kind() == reflect.Struct {
+			for i := 0; i < ft.NumField(); i++ {
+				b.property(ft.Field(i), obj)
+			}
+			return
+		}
+	}
+	if name == "" {
+		name = f.Name
+	}
+	schema := b.schema(f.Type)
+	validateTag := f.Tag.Get("validate")
+	if schema.Ref == "" {
+		applyValidateTag(schema, validateTag, derefType(f.Type))
+	}
+	if hasValidateRule(validateTag, "required") {
+		obj.Required = append(obj.Required, name)
+	}
+	obj.Properties[name] = schema
+}
+
+// schema returns the schema of the type, named struct types are registered as components and referenced
+func (b *schemaBuilder) schema(t reflect.Type) *Schema {
+	t = derefType(t)
+	switch t {
+	case typeTime:
+		return &Schema{Type: "string", Format: "date-time"}
+	case typeBytes:
+		return &Schema{Type: "string", Format: "byte"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: "integer", Minimum: &zero}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		name, exists := b.names[t]
+		if !exists {
+			name = b.componentName(t)
+			b.names[t] = name
+			// register before building, so that recursive types refer to themselves
+			b.schemas[name] = &Schema{}
+			*b.schemas[name] = *b.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+func (b *schemaBuilder) object(t reflect.Type) *Schema {
+	obj := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		b.property(t.Field(i), obj)
+	}
+	return obj
+}
+
+func (b *schemaBuilder) componentName(t reflect.Type) string {
+	name := typeRefId.ReplaceAllString(t.Name(), "_")
+	candidate := name
+	for i := 2; ; i++ {
+		if _, exists := b.schemas[candidate]; !exists {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+}
+
+// applyValidateTag translates the rules of the validate tag to schema constraints
+func applyValidateTag(schema *Schema, validateTag string, t reflect.Type) {
+	fieldTag, elemTag, dive := splitDiveTag(validateTag)
+	if dive {
+		// the rules of the elements are applied to the inline schemas only, not to the referenced components
+		if _, valueTag, err := splitKeysTag(elemTag); err == nil {
+			if elem := schema.Items; elem != nil && elem.Ref == "" {
+				applyValidateTag(elem, valueTag, derefType(t.Elem()))
+			} else if elem = schema.AdditionalProperties; elem != nil && elem.Ref == "" {
+				applyValidateTag(elem, valueTag, derefType(t.Elem()))
+			}
+		}
+	}
+	for _, frag := range strings.Split(fieldTag, ";") {
+		frag = strings.TrimSpace(frag)
+		switch {
+		case frag == "email":
+			schema.Format = "email"
+		case frag == "url":
+			schema.Format = "uri"
+		case frag == "uuid", frag == "ipv4", frag == "ipv6", frag == "hostname":
+			schema.Format = frag
+		case frag == "e164":
+			schema.Pattern = e164Regex.String()
+		case strings.HasPrefix(frag, "regex="):
+			schema.Pattern = strings.TrimPrefix(frag, "regex=")
+		case strings.HasPrefix(frag, "datetime="):
+			switch strings.TrimPrefix(frag, "datetime=") {
+			case time.RFC3339, time.RFC3339Nano:
+				schema.Format = "date-time"
+			case time.DateOnly:
+				schema.Format = "date"
+			case time.TimeOnly:
+				schema.Format = "time"
+			}
+		case strings.HasPrefix(frag, "oneof="):
+			schema.Enum = nil
+			for _, option := range strings.Fields(strings.TrimPrefix(frag, "oneof=")) {
+				if t.Kind() == reflect.String {
+					schema.Enum = append(schema.Enum, option)
+				} else if n, err := strconv.ParseInt(option, 10, 64); err == nil {
+					schema.Enum = append(schema.Enum, n)
+				}
+			}
+		case frag == "unique":
+			schema.UniqueItems = true
+		case strings.HasPrefix(frag, "min_items="):
+			if n, err := strconv.Atoi(strings.TrimPrefix(frag, "min_items=")); err == nil {
+				schema.MinItems = &n
+			}
+		case strings.HasPrefix(frag, "max_items="):
+			if n, err := strconv.Atoi(strings.TrimPrefix(frag, "max_items=")); err == nil {
+				schema.MaxItems = &n
+			}
+		case strings.HasPrefix(frag, "min="):
+			applyNumberInterval(schema, interval{lower: strings.TrimPrefix(frag, "min=")})
+		case strings.HasPrefix(frag, "max="):
+			applyNumberInterval(schema, interval{upper: strings.TrimPrefix(frag, "max=")})
+		case strings.HasPrefix(frag, "range="):
+			if iv, ok := parseInterval(strings.TrimPrefix(frag, "range=")); ok {
+				applyNumberInterval(schema, iv)
+			}
+		case strings.HasPrefix(frag, "between="):
+			lower, upper, _ := strings.Cut(strings.TrimPrefix(frag, "between="), ",")
+			applyNumberInterval(schema, interval{lower: strings.TrimSpace(lower), upper: strings.TrimSpace(upper)})
+		case strings.HasPrefix(frag, "len="):
+			arg := strings.TrimPrefix(frag, "len=")
+			if iv, ok := parseInterval(arg); ok {
+				applyLengthInterval(schema, iv, t)
+			} else {
+				applyLengthInterval(schema, interval{lower: arg, upper: arg}, t)
+			}
+		case strings.HasPrefix(frag, "min_len="):
+			applyLengthInterval(schema, interval{lower: strings.TrimPrefix(frag, "min_len=")}, t)
+		case strings.HasPrefix(frag, "max_len="):
+			applyLengthInterval(schema, interval{upper: strings.TrimPrefix(frag, "max_len=")}, t)
+		default:
+			// the legacy range tags like [1,10]
+			if iv, ok := parseInterval(frag); ok {
+				if t.Kind() == reflect.String {
+					applyLengthInterval(schema, iv, t)
+				} else {
+					applyNumberInterval(schema, iv)
+				}
+			}
+		}
+	}
+}
+
+func applyNumberInterval(schema *Schema, iv interval) {
+	if v, err := strconv.ParseFloat(iv.lower, 64); err == nil {
+		if iv.lowerOpen {
+			schema.ExclusiveMinimum = &v
+		} else {
+			schema.Minimum = &v
+		}
+	}
+	if v, err := strconv.ParseFloat(iv.upper, 64); err == nil {
+		if iv.upperOpen {
+			schema.ExclusiveMaximum = &v
+		} else {
+			schema.Maximum = &v
+		}
+	}
+}
+
+// applyLengthInterval applies the length interval to the strings and the arrays
+func applyLengthInterval(schema *Schema, iv interval, t reflect.Type) {
+	var minLen, maxLen *int
+	if n, err := strconv.Atoi(iv.lower); err == nil {
+		if iv.lowerOpen {
+			n++
+		}
+		minLen = &n
+	}
+	if n, err := strconv.Atoi(iv.upper); err == nil {
+		if iv.upperOpen {
+			n--
+		}
+		maxLen = &n
+	}
+	minField, maxField := &schema.MinLength, &schema.MaxLength
+	switch t.Kind() {
+	case reflect.String:
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is a base64 string in JSON
+			return
+		}
+		minField, maxField = &schema.MinItems, &schema.MaxItems
+	default:
+		return
+	}
+	if minLen != nil {
+		*minField = minLen
+	}
+	if maxLen != nil {
+		*maxField = maxLen
+	}
+}
+
+func hasValidateRule(validateTag, rule string) bool {
+	fieldTag, _, _ := splitDiveTag(validateTag)
+	for _, frag := range strings.Split(fieldTag, ";") {
+		if strings.TrimSpace(frag) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// openAPIPath converts the endpoint pattern to an OpenAPI path template,
+// the sections without a name are named after their position
+func openAPIPath(pattern string) (string, []*Parameter) {
+	pattern = strings.ReplaceAll(strings.TrimSpace(pattern), "//", "/")
+	parts := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	var params []*Parameter
+	addParam := func(p *Parameter) string {
+		if p.Name == "" {
+			p.Name = "param" + strconv.Itoa(len(params)+1)
+		}
+		p.In = "path"
+		p.Required = true
+		params = append(params, p)
+		return "{" + p.Name + "}"
+	}
+	for i, part := range parts {
+		seg, err := parseSegment(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch seg.kind {
+		case segmentAny:
+			parts[i] = addParam(&Parameter{Schema: &Schema{Type: "string"}})
+		case segmentCatchAll:
+			// OpenAPI does not allow the slashes in path parameters, the rest of the path is documented as one
+			name := seg.name
+			if name == catchAllName {
+				name = ""
+			}
+			parts[i] = addParam(&Parameter{Name: name, Description: "The rest of the path", Schema: &Schema{Type: "string"}})
+		case segmentRegexp:
+			parts[i] = addParam(&Parameter{Schema: &Schema{Type: "string", Pattern: seg.exp.String()}})
+		case segmentString:
+			p := &Parameter{Schema: &Schema{Type: "string", MinLength: new(int)}}
+			*p.Schema.MinLength = 1
+			parts[i] = addParam(p)
+		case segmentInt:
+			parts[i] = addParam(&Parameter{Schema: &Schema{Type: "integer", Format: "int64"}})
+		case segmentNamedRegexp:
+			parts[i] = addParam(&Parameter{Name: seg.name, Schema: &Schema{Type: "string", Pattern: seg.exp.String()}})
+		case segmentNamed:
+			parts[i] = addParam(&Parameter{Name: seg.name, Schema: &Schema{Type: "string"}})
+		case segmentMixed:
+			tokens, _ := splitSegment(seg.raw)
+			var template strings.Builder
+			for _, t := range tokens {
+				if t.param == nil {
+					template.WriteString(t.text)
+					continue
+				}
+				schema := &Schema{Type: "string"}
+				if t.param.expr != "" {
+					schema.Pattern = t.param.expr
+				}
+				template.WriteString(addParam(&Parameter{Name: t.param.name, Schema: schema}))
+			}
+			parts[i] = template.String()
+		}
+	}
+	return "/" + strings.Join(parts, "/"), params
+}
+
+func methodHasBody(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// openAPIHandlers returns the handlers serving the OpenAPI document and the docs UI
+func (s *Server) openAPIHandlers() (map[epSig]func(*Context), error) {
+	handlers := make(map[epSig]func(*Context))
+	if s.OpenAPIPath == "" {
+		return handlers, nil
+	}
+	raw, err := json.Marshal(s.OpenAPI())
+	if err != nil {
+		return nil, errs.Wrap(err, "Failed to build the OpenAPI document of server [{0}]", s.Name)
+	}
+	handlers[epSig{method: http.MethodGet, pattern: s.OpenAPIPath}] = func(ctx *Context) {
+		ctx.Writer.Header().Set("Content-Type", MimeJson)
+		ctx.Writer.Write(raw)
+	}
+	if s.DocsPath == "" {
+		return handlers, nil
+	}
+	// the assets are served next to the page, so that the docs UI works offline and under a strict CSP
+	assets := map[string]string{
+		"docs.js":  "text/javascript; charset=utf-8",
+		"docs.css": "text/css; charset=utf-8",
+	}
+	var page bytes.Buffer
+	err = docsTemplate.Execute(&page, map[string]string{
+		"Title":  s.Name,
+		"Spec":   s.OpenAPIPath,
+		"Script": path.Join(s.DocsPath, "docs.js"),
+		"Style":  path.Join(s.DocsPath, "docs.css"),
+	})
+	if err != nil {
+		return nil, errs.Wrap(err, "Failed to render the docs page of server [{0}]", s.Name)
+	}
+	handlers[epSig{method: http.MethodGet, pattern: s.DocsPath}] = func(ctx *Context) {
+		ctx.Writer.Header().Set("Content-Type", MimeHtml+"; charset=utf-8")
+		ctx.Writer.Write(page.Bytes())
+	}
+	for name, contentType := range assets {
+		asset, err := docsFS.ReadFile("docs/" + name)
+		if err != nil {
+			return nil, errs.Wrap(err, "Failed to load the docs asset [{0}]", name)
+		}
+		handlers[epSig{method: http.MethodGet, pattern: path.Join(s.DocsPath, name)}] = func(ctx *Context) {
+			ctx.Writer.Header().Set("Content-Type", contentType)
+			ctx.Writer.Write(asset)
+		}
+	}
+	return handlers, nil
+}
+
+// docsFS holds the docs UI, it renders the OpenAPI document without any third-party asset
+//
+//go:embed docs
+var docsFS embed.FS
+
+var docsTemplate = template.Must(template.ParseFS(docsFS, "docs/index.html"))
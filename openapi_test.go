@@ -0,0 +1,149 @@
+package sprout
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type openAPITestUser struct {
+	Id     string            `json:"id"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Friend *openAPITestUser  `json:"friend,omitempty"`
+	secret string
+}
+
+type openAPITestQuery struct {
+	Id     string   `path:"id"`
+	Fields []string `query:"fields" validate:"max_items=3;unique"`
+	Token  string   `header:"X-Token" validate:"required"`
+}
+
+type openAPITestCreate struct {
+	Version string   `path:"version"`
+	Name    string   `json:"name" validate:"required;[1,32]"`
+	Email   string   `json:"email" validate:"email"`
+	Age     int      `json:"age" validate:"range=[0,150)"`
+	Role    string   `json:"role" validate:"oneof=admin user"`
+	Tags    []string `json:"tags" validate:"min_items=1;dive;max_len=8"`
+	Ignored string   `json:"-"`
+}
+
+type openAPITestCreated struct {
+	Status   int             `status:"201"`
+	Location string          `header:"Location"`
+	User     openAPITestUser `body:""`
+}
+
+type openAPITestUpload struct {
+	Title string      `form:"title" validate:"required"`
+	Files []*FormFile `form:"files"`
+}
+
+type openAPITestFile struct {
+	Path string `path:"path"`
+}
+
+func newOpenAPITestServer(t *testing.T) *Server {
+	t.Helper()
+	svr := newDefaultServer("test")
+	svr.APIVersion = "1.0.0"
+	mountTestEndpoints(t, svr,
+		&Endpoint[openAPITestQuery, openAPITestUser]{
+			Name:    "getUser",
+			Pattern: "/users/{id:~[0-9]+}",
+			Methods: []string{http.MethodGet},
+			Handler: func(ctx *Context, in openAPITestQuery) (openAPITestUser, error) {
+				return openAPITestUser{}, nil
+			},
+		},
+		&Endpoint[openAPITestCreate, openAPITestCreated]{
+			Name:    "createUser",
+			Pattern: "/v{version}/users",
+			Methods: []string{http.MethodPost},
+			Handler: func(ctx *Context, in openAPITestCreate) (openAPITestCreated, error) {
+				return openAPITestCreated{}, nil
+			},
+		},
+		&Endpoint[openAPITestUpload, Response[[]string]]{
+			Name:    "upload",
+			Pattern: "/uploads",
+			Methods: []string{http.MethodPost},
+			Handler: func(ctx *Context, in openAPITestUpload) (Response[[]string], error) {
+				return Response[[]string]{}, nil
+			},
+		},
+		&Endpoint[openAPITestFile, []byte]{
+			Name:    "file",
+			Pattern: "/files/{path...}",
+			Methods: []string{http.MethodGet},
+			Handler: func(ctx *Context, in openAPITestFile) ([]byte, error) {
+				return nil, nil
+			},
+		},
+	)
+	return svr
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	raw, err := json.MarshalIndent(newOpenAPITestServer(t).OpenAPI(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile("testdata/openapi.golden.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(raw) + "\n"; got != string(golden) {
+		t.Errorf("unexpected OpenAPI document:\n%s", got)
+	}
+}
+
+func TestOpenAPIDocsPage(t *testing.T) {
+	svr := newOpenAPITestServer(t)
+	svr.OpenAPIPath = "/openapi.json"
+	svr.DocsPath = "/docs"
+	mx := newServerTestMux(t, svr)
+	for _, c := range []struct {
+		path        string
+		contentType string
+		contains    string
+	}{
+		{"/openapi.json", MimeJson, `"openapi":"3.1.0"`},
+		{"/docs", MimeHtml, `data-spec="/openapi.json"`},
+		{"/docs/docs.js", "text/javascript", "data-spec"},
+		{"/docs/docs.css", "text/css", "details"},
+	} {
+		w := serve(mx, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), c.contentType) {
+			t.Errorf("%s: expected %s, got %d %s", c.path, c.contentType, w.Code, w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), c.contains) {
+			t.Errorf("%s: expected the body to contain %s", c.path, c.contains)
+		}
+		// the docs UI is self-contained
+		if strings.Contains(w.Body.String(), "https://") {
+			t.Errorf("%s: expected no third-party assets", c.path)
+		}
+	}
+}
+
+func TestOpenAPIRequestMediaTypes(t *testing.T) {
+	svr := newOpenAPITestServer(t)
+	// the media types disabled by the server are not documented, the ones added by it are
+	svr.Deserializers = map[string]Deserializer{MimeUrlencodedForm: nil, "application/vnd.acme+json": DeserializeJson}
+	doc := svr.OpenAPI()
+	var types []string
+	for mediaType := range (*doc.Paths["/v{version}/users"])["post"].RequestBody.Content {
+		types = append(types, mediaType)
+	}
+	slices.Sort(types)
+	if expected := []string{MimeJson, "application/vnd.acme+json", MimeMultipartForm}; !slices.Equal(types, expected) {
+		t.Errorf("expected the request media types %v, got %v", expected, types)
+	}
+}
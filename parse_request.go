@@ -25,9 +25,8 @@ func parseHttpRequest[T any](in *T, r *http.Request, decrypters map[string]func(
 
 		var queryMap map[string]string
 		if key, ok := tag.Lookup("path"); ok {
-			pathParams := r.Context().Value(ctxKeyPathParams)
-			if pathParams != nil {
-				if val, exists := pathParams.(map[string]string)[key]; exists {
+			if pathParams, ok := r.Context().Value(ctxKeyPathParams).(*pathParams); ok {
+				if val, exists := pathParams.get(key); exists {
 					valStr = &val
 				}
 			}
@@ -81,7 +80,7 @@ func parseHttpRequest[T any](in *T, r *http.Request, decrypters map[string]func(
 		}
 	}
 
-	return parseHttpRequestBody(in, r)
+	return parseHttpRequestBody(in, withDecrypters(r, decrypters))
 }
 
 func parseHttpRequestBody[T any](t *T, r *http.Request) error {
@@ -0,0 +1,248 @@
+package sprout
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/rflt"
+)
+
+// Response wraps the body of an endpoint output with the status, headers and cookies of the response,
+// eg. Handler[I, Response[User]] returning Response[User]{Status: 201, Header: http.Header{"Location": {url}}, Body: u}
+type Response[T any] struct {
+	// status code of the response, 200 is used if zero, or 204 if the body is zero
+	Status  int            `status:""`
+	Header  http.Header    `header:""`
+	Cookies []*http.Cookie `cookie:""`
+	Body    T              `body:""`
+}
+
+// responseEnvelope writes the outputs whose fields are tagged with status, header, cookie or body, see Example_outputTags
+type responseEnvelope struct {
+	outputType reflect.Type
+	status     int
+	// the status declared by the tag of the status field, eg. status:"201", used if the field is zero
+	declaredStatus int
+	headers        []envelopeField
+	cookies        []envelopeField
+	body           int
+	// the struct type of the rest fields if there is no body field, and the indexes of the fields
+	restType   reflect.Type
+	restFields []int
+}
+
+type envelopeField struct {
+	idx  int
+	name string
+}
+
+var (
+	typeHttpHeader  = reflect.TypeOf(http.Header{})
+	typeHttpCookie  = reflect.TypeOf(http.Cookie{})
+	typeHttpCookies = reflect.TypeOf([]*http.Cookie{})
+)
+
+// newResponseEnvelope inspects the output type, nil is returned if the output has no envelope fields
+func newResponseEnvelope(outputType reflect.Type) (env *responseEnvelope, err error) {
+	t := derefType(outputType)
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	env = &responseEnvelope{outputType: t, status: -1, body: -1}
+	var found bool
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if code, ok := f.Tag.Lookup("status"); ok {
+			if f.Type.Kind() != reflect.Int {
+				return nil, errs.New("The status field [{0}] of output [{1}] must be of int type", f.Name, t)
+			}
+			if code != "" {
+				status, err := strconv.Atoi(code)
+				if err != nil || status < 200 || status > 599 {
+					return nil, errs.New("The status [{0}] declared by field [{1}] of output [{2}] is not a valid status code", code, f.Name, t)
+				}
+				env.declaredStatus = status
+			}
+			env.status, found = i, true
+		} else if name, ok := f.Tag.Lookup("header"); ok {
+			if name == "" && f.Type != typeHttpHeader {
+				return nil, errs.New("The header field [{0}] of output [{1}] must be named by the tag, or be of http.Header type", f.Name, t)
+			}
+			env.headers, found = append(env.headers, envelopeField{idx: i, name: name}), true
+		} else if name, ok := f.Tag.Lookup("cookie"); ok {
+			switch {
+			case f.Type == typeHttpCookie, f.Type == reflect.PointerTo(typeHttpCookie), f.Type == typeHttpCookies:
+			case f.Type.Kind() == reflect.String && name != "":
+			default:
+				return nil, errs.New("The cookie field [{0}] of output [{1}] must be of string type named by the tag, "+
+					"or of http.Cookie, *http.Cookie or []*http.Cookie type", f.Name, t)
+			}
+			env.cookies, found = append(env.cookies, envelopeField{idx: i, name: name}), true
+		} else if _, ok := f.Tag.Lookup("body"); ok {
+			if env.body >= 0 {
+				return nil, errs.New("Output [{0}] has more than one body field", t)
+			}
+			env.body, found = i, true
+		} else if f.IsExported() {
+			env.restFields = append(env.restFields, i)
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	if env.body < 0 && len(env.restFields) > 0 {
+		fields := make([]reflect.StructField, len(env.restFields))
+		for i, idx := range env.restFields {
+			fields[i] = t.Field(idx)
+			fields[i].Index, fields[i].Offset = nil, 0
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				err = errs.New("Failed to build the body type of output [{0}], tag the body field with body:\"\" instead: {1}", t, fmt.Sprint(r))
+			}
+		}()
+		env.restType = reflect.StructOf(fields)
+	}
+	return env, nil
+}
+
+// bodyType returns the type of the response body, nil if there is no body
+func (e *responseEnvelope) bodyType() reflect.Type {
+	if e.body >= 0 {
+		return e.outputType.Field(e.body).Type
+	}
+	return e.restType
+}
+
+// write writes the status, headers, cookies and body of the output to the response
+func (e *responseEnvelope) write(ctx *Context, out reflect.Value) error {
+	for out.Kind() == reflect.Pointer {
+		if out.IsNil() {
+			ctx.Writer.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		out = out.Elem()
+	}
+	header := ctx.Writer.Header()
+	for _, h := range e.headers {
+		if err := setEnvelopeHeader(header, h.name, out.Field(h.idx)); err != nil {
+			return err
+		}
+	}
+	for _, c := range e.cookies {
+		setEnvelopeCookie(ctx.Writer, c.name, out.Field(c.idx))
+	}
+
+	var body reflect.Value
+	if e.body >= 0 {
+		body = out.Field(e.body)
+	} else if e.restType != nil {
+		body = reflect.New(e.restType).Elem()
+		for i, idx := range e.restFields {
+			body.Field(i).Set(out.Field(idx))
+		}
+	}
+	hasBody := body.IsValid() && !body.IsZero()
+
+	status := 0
+	if e.status >= 0 {
+		status = int(out.Field(e.status).Int())
+	}
+	if status == 0 {
+		status = e.declaredStatus
+	}
+	if status == 0 {
+		status = http.StatusOK
+		if !hasBody {
+			status = http.StatusNoContent
+		}
+	}
+	if !hasBody || !bodyAllowed(status) {
+		ctx.Writer.WriteHeader(status)
+		return nil
+	}
+	header.Set("Content-Type", ctx.Value(ctxKeyAcceptType).(string))
+	ctx.Writer.WriteHeader(status)
+	serializer := ctx.Value(ctxKeySerializer).(Serializer)
+	return serializer(body.Interface(), ctx.Writer)
+}
+
+// bodyAllowed reports whether a response of the status may have a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+func setEnvelopeHeader(header http.Header, name string, fv reflect.Value) error {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	switch {
+	case fv.Type() == typeHttpHeader:
+		for k, vals := range fv.Interface().(http.Header) {
+			for _, v := range vals {
+				header.Add(k, v)
+			}
+		}
+	case fv.Type() == typeTime:
+		if t := fv.Interface().(time.Time); !t.IsZero() {
+			header.Set(name, t.UTC().Format(http.TimeFormat))
+		}
+	case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String:
+		for i := 0; i < fv.Len(); i++ {
+			header.Add(name, fv.Index(i).String())
+		}
+	case fv.Kind() == reflect.String:
+		if s := fv.String(); s != "" {
+			header.Set(name, s)
+		}
+	case fv.Kind() == reflect.Int || fv.Kind() == reflect.Int64:
+		header.Set(name, strconv.FormatInt(fv.Int(), 10))
+	default:
+		if fv.IsZero() {
+			return nil
+		}
+		s, err := rflt.ValueToString(fv)
+		if err != nil {
+			return errs.Wrap(err, "Failed to convert the value of header [{0}]", name)
+		}
+		header.Set(name, s)
+	}
+	return nil
+}
+
+func setEnvelopeCookie(w http.ResponseWriter, name string, fv reflect.Value) {
+	switch fv.Type() {
+	case typeHttpCookies:
+		for _, c := range fv.Interface().([]*http.Cookie) {
+			if c != nil {
+				http.SetCookie(w, c)
+			}
+		}
+	case typeHttpCookie:
+		c := fv.Interface().(http.Cookie)
+		if c.Name == "" {
+			c.Name = name
+		}
+		if c.Name != "" {
+			http.SetCookie(w, &c)
+		}
+	case reflect.PointerTo(typeHttpCookie):
+		if c := fv.Interface().(*http.Cookie); c != nil {
+			if c.Name == "" {
+				c.Name = name
+			}
+			http.SetCookie(w, c)
+		}
+	default:
+		if s := fv.String(); s != "" {
+			http.SetCookie(w, &http.Cookie{Name: name, Value: s})
+		}
+	}
+}
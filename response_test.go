@@ -0,0 +1,230 @@
+package sprout
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type responseTestInput struct {
+	Id string `query:"id"`
+}
+
+type responseTestUser struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type responseTestOutput struct {
+	Status   int       `status:""`
+	Location string    `header:"Location"`
+	Expires  time.Time `header:"Expires"`
+	Links    []string  `header:"Link"`
+	Count    int       `header:"X-Count"`
+	Session  string    `cookie:"sid"`
+	Id       string    `json:"id"`
+	Name     string    `json:"name,omitempty"`
+	internal string
+}
+
+// serveOutput serves the output returned by an endpoint
+func serveOutput[O any](t *testing.T, out O) *httptest.ResponseRecorder {
+	t.Helper()
+	mx := newTestMux(t, &Endpoint[responseTestInput, O]{
+		Name:    "output",
+		Pattern: "/output",
+		Methods: []string{http.MethodGet},
+		Handler: func(ctx *Context, in responseTestInput) (O, error) { return out, nil },
+	})
+	return serve(mx, httptest.NewRequest(http.MethodGet, "/output", nil))
+}
+
+func TestResponseEnvelopeTags(t *testing.T) {
+	expires := time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("CST", 8*3600))
+	w := serveOutput(t, responseTestOutput{
+		Status:   http.StatusCreated,
+		Location: "/users/1",
+		Expires:  expires,
+		Links:    []string{"</users/2>; rel=next", "</users/0>; rel=prev"},
+		Count:    7,
+		Session:  "abc",
+		Id:       "1",
+		internal: "internal",
+	})
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", w.Code)
+	}
+	for name, expected := range map[string]string{
+		"Location":   "/users/1",
+		"Expires":    "Thu, 01 Jan 2026 19:04:05 GMT",
+		"X-Count":    "7",
+		"Set-Cookie": "sid=abc",
+	} {
+		if got := w.Header().Get(name); got != expected {
+			t.Errorf("expected header %s to be %q, got %q", name, expected, got)
+		}
+	}
+	if links := w.Header().Values("Link"); len(links) != 2 {
+		t.Errorf("expected 2 links, got %v", links)
+	}
+	// the body consists of the rest fields
+	if body := strings.TrimSpace(w.Body.String()); body != `{"id":"1"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+}
+
+func TestResponseEnvelopeStatus(t *testing.T) {
+	user := responseTestUser{Id: "1", Name: "sprout"}
+	for _, c := range []struct {
+		name   string
+		w      *httptest.ResponseRecorder
+		status int
+		body   string
+	}{
+		{"default", serveOutput(t, Response[responseTestUser]{Body: user}), http.StatusOK, `{"id":"1","name":"sprout"}`},
+		{"zero body", serveOutput(t, Response[*responseTestUser]{}), http.StatusNoContent, ""},
+		{"no body allowed", serveOutput(t, Response[responseTestUser]{Status: http.StatusNotModified, Body: user}), http.StatusNotModified, ""},
+		{"nil output", serveOutput[*Response[responseTestUser]](t, nil), http.StatusNoContent, ""},
+		{"only envelope fields", serveOutput(t, struct {
+			Status int `status:""`
+		}{Status: http.StatusAccepted}), http.StatusAccepted, ""},
+		{"declared status", serveOutput(t, struct {
+			Status int    `status:"201"`
+			Id     string `json:"id"`
+		}{Id: "1"}), http.StatusCreated, `{"id":"1"}`},
+		{"declared status overridden", serveOutput(t, struct {
+			Status int    `status:"201"`
+			Id     string `json:"id"`
+		}{Status: http.StatusOK, Id: "1"}), http.StatusOK, `{"id":"1"}`},
+	} {
+		if c.w.Code != c.status || strings.TrimSpace(c.w.Body.String()) != c.body {
+			t.Errorf("%s: expected %d %s, got %d %s", c.name, c.status, c.body, c.w.Code, c.w.Body.String())
+		}
+	}
+}
+
+func TestResponseEnvelopeCookies(t *testing.T) {
+	w := serveOutput(t, struct {
+		Header  http.Header    `header:""`
+		Theme   http.Cookie    `cookie:"theme"`
+		Lang    *http.Cookie   `cookie:""`
+		Cookies []*http.Cookie `cookie:""`
+		Body    []string       `body:""`
+	}{
+		Header:  http.Header{"X-A": {"1", "2"}},
+		Theme:   http.Cookie{Value: "dark"},
+		Lang:    &http.Cookie{Name: "lang", Value: "en"},
+		Cookies: []*http.Cookie{{Name: "a", Value: "1"}, nil},
+		Body:    []string{"ok"},
+	})
+	if got := w.Header().Values("X-A"); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("expected all the headers to be added, got %v", got)
+	}
+	if got := w.Header().Values("Set-Cookie"); !reflect.DeepEqual(got, []string{"theme=dark", "lang=en", "a=1"}) {
+		t.Errorf("unexpected cookies %v", got)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `["ok"]` {
+		t.Errorf("expected the body field to be the body, got %s", body)
+	}
+}
+
+func TestNewResponseEnvelope(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		output   any
+		bodyType reflect.Type
+		invalid  string
+	}{
+		{"not a struct", "", nil, ""},
+		{"no envelope field", responseTestUser{}, nil, ""},
+		{"body field", Response[responseTestUser]{}, reflect.TypeOf(responseTestUser{}), ""},
+		{"rest fields", responseTestOutput{}, reflect.TypeOf(struct {
+			Id   string `json:"id"`
+			Name string `json:"name,omitempty"`
+		}{}), ""},
+		{"status type", struct {
+			Status string `status:""`
+		}{}, nil, "must be of int type"},
+		{"declared status", struct {
+			Status int `status:"created"`
+		}{}, nil, "not a valid status code"},
+		{"declared status out of range", struct {
+			Status int `status:"99"`
+		}{}, nil, "not a valid status code"},
+		{"unnamed header", struct {
+			Location string `header:""`
+		}{}, nil, "must be named by the tag"},
+		{"cookie type", struct {
+			Session int `cookie:"sid"`
+		}{}, nil, "must be of string type"},
+		{"two bodies", struct {
+			A string `body:""`
+			B string `body:""`
+		}{}, nil, "more than one body field"},
+		// reflect.StructOf does not support the embedded types with methods after the first field
+		{"embedded type with methods", struct {
+			Status int `status:""`
+			Id     string
+			time.Time
+		}{}, nil, "tag the body field"},
+	} {
+		env, err := newResponseEnvelope(reflect.TypeOf(c.output))
+		if c.invalid != "" {
+			if err == nil || !strings.Contains(err.Error(), c.invalid) {
+				t.Errorf("%s: expected the error %q, got %v", c.name, c.invalid, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if c.bodyType == nil {
+			if env != nil {
+				t.Errorf("%s: expected no envelope", c.name)
+			}
+			continue
+		}
+		if env == nil || env.bodyType() != c.bodyType {
+			t.Errorf("%s: expected the body type %v, got %+v", c.name, c.bodyType, env)
+		}
+	}
+}
+
+// The fields of an output are tagged like the ones of an input. The status field must be of int type, the status
+// declared by its tag, eg. status:"201", is used if it is zero, or 200, or 204 if the body is zero. A header field
+// of string type, or any type converted by rflt.ValueToString, sets the header named by the tag, time.Time values
+// are formatted as http dates and []string values add all of them; a header field of http.Header type with empty
+// tag adds all of its headers. A cookie field of string type sets the cookie named by the tag, the fields of
+// http.Cookie, *http.Cookie and []*http.Cookie type set the cookies as they are. The body is the field tagged
+// with body:"" if any, or the rest fields of the output otherwise.
+func Example_outputTags() {
+	type CreateUserOutput struct {
+		Status   int    `status:"201"`
+		Location string `header:"Location"`
+		Session  string `cookie:"sid"`
+		Id       string `json:"id"`
+	}
+	svr := newDefaultServer("example")
+	_ = (&Endpoint[responseTestInput, CreateUserOutput]{
+		Name:    "createUser",
+		Pattern: "/users",
+		Methods: []string{http.MethodPost},
+		Handler: func(ctx *Context, in responseTestInput) (CreateUserOutput, error) {
+			return CreateUserOutput{Location: "/users/1", Session: "abc", Id: "1"}, nil
+		},
+	}).appendToServer(svr, nil, nil)
+	mx, _ := svr.buildMux()
+
+	w := httptest.NewRecorder()
+	mx.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users", nil))
+	fmt.Println(w.Code, w.Header().Get("Location"), w.Header().Get("Set-Cookie"))
+	fmt.Print(w.Body.String())
+	// Output:
+	// 201 /users/1 sid=abc
+	// {"id":"1"}
+}
@@ -0,0 +1,506 @@
+package sprout
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wxy365/basal/ds/slices"
+	"github.com/wxy365/basal/errs"
+)
+
+// segmentKind is the kind of a pattern segment, the kinds are tried in the order of their values
+type segmentKind int
+
+const (
+	// static text, eg. users
+	segmentStatic segmentKind = iota
+	// static text mixed with parameters, eg. v{version:~\d+} or {name}.{ext}, the ones with more static text first
+	segmentMixed
+	// %d, an integer
+	segmentInt
+	// %s, a non-empty string
+	segmentString
+	// {name:~regex}, a named segment matching the regular expression
+	segmentNamedRegexp
+	// ~regex, a segment matching the regular expression
+	segmentRegexp
+	// {name}, any named segment
+	segmentNamed
+	// *, any segment
+	segmentAny
+	// {name...} or **, the rest of the path, which may be empty, and should be the last segment
+	segmentCatchAll
+)
+
+var segmentKindNames = [...]string{"static", "mixed", "%d", "%s", "named-regexp", "regexp", "named", "any", "catch-all"}
+
+func (k segmentKind) String() string {
+	return segmentKindNames[k]
+}
+
+// segment is a parsed section of an endpoint pattern between two slashes
+type segment struct {
+	kind segmentKind
+	// the pattern text of the segment
+	raw string
+	// name of the path parameter captured by the segment
+	name string
+	exp  *regexp.Regexp
+	// the parameters of a mixed segment, and their submatch indexes in exp
+	params []segmentParam
+	groups []int
+	// length of the static text of a mixed segment
+	literal int
+}
+
+// segmentParam is a parameter in a segment, expr is the regular expression it matches, empty for any text
+type segmentParam struct {
+	name string
+	expr string
+}
+
+// segmentToken is a piece of a segment, either static text or a parameter in braces
+type segmentToken struct {
+	text  string
+	param *segmentParam
+}
+
+// catchAllName is the name of the path parameter captured by the ** segment
+const catchAllName = "**"
+
+func parseSegment(raw string) (segment, error) {
+	s := segment{raw: raw}
+	switch {
+	case raw == "*":
+		s.kind = segmentAny
+	case raw == "**":
+		s.kind, s.name = segmentCatchAll, catchAllName
+	case expCatchAll.MatchString(raw):
+		s.kind, s.name = segmentCatchAll, raw[1:len(raw)-4]
+	case strings.HasPrefix(raw, "~"):
+		exp, err := regexp.Compile(raw[1:])
+		if err != nil {
+			return s, errs.Wrap(err, "Invalid regular expression in uri pattern section [{0}]", raw)
+		}
+		s.kind, s.exp = segmentRegexp, exp
+	case raw == "%s":
+		s.kind = segmentString
+	case raw == "%d":
+		s.kind = segmentInt
+	case strings.Contains(raw, "{"):
+		tokens, err := splitSegment(raw)
+		if err != nil {
+			return s, err
+		}
+		if len(tokens) == 1 {
+			s.name = tokens[0].param.name
+			if tokens[0].param.expr == "" {
+				s.kind = segmentNamed
+				return s, nil
+			}
+			exp, err := regexp.Compile(tokens[0].param.expr)
+			if err != nil {
+				return s, errs.Wrap(err, "Invalid regular expression in uri pattern section [{0}]", raw)
+			}
+			s.kind, s.exp = segmentNamedRegexp, exp
+			return s, nil
+		}
+		return mixedSegment(raw, tokens)
+	case raw == "" || expStatic.MatchString(raw):
+		// the empty segment is the trailing slash of the patterns like /users/
+		s.kind = segmentStatic
+	default:
+		return s, errs.New("Invalid uri pattern section [{0}]", raw)
+	}
+	return s, nil
+}
+
+// splitSegment splits the segment into static text and parameters like {name} or {name:~regex},
+// the braces in the regular expressions should be balanced
+func splitSegment(raw string) ([]segmentToken, error) {
+	var tokens []segmentToken
+	for rest := raw; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			open = len(rest)
+		}
+		if open > 0 {
+			if !expStatic.MatchString(rest[:open]) {
+				return nil, errs.New("Invalid uri pattern section [{0}]", raw)
+			}
+			tokens = append(tokens, segmentToken{text: rest[:open]})
+			rest = rest[open:]
+			continue
+		}
+		depth, end := 0, -1
+		for i := 0; i < len(rest) && end < 0; i++ {
+			switch rest[i] {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			return nil, errs.New("Unbalanced braces in uri pattern section [{0}]", raw)
+		}
+		name, expr, hasExpr := strings.Cut(rest[1:end], ":")
+		if !expParamName.MatchString(name) || hasExpr && !strings.HasPrefix(expr, "~") {
+			return nil, errs.New("Invalid uri pattern section [{0}]", raw)
+		}
+		if len(tokens) > 0 && tokens[len(tokens)-1].param != nil {
+			return nil, errs.New("Adjacent parameters in uri pattern section [{0}] can not be told apart", raw)
+		}
+		tokens = append(tokens, segmentToken{param: &segmentParam{name: name, expr: strings.TrimPrefix(expr, "~")}})
+		rest = rest[end+1:]
+	}
+	return tokens, nil
+}
+
+// mixedSegment compiles the tokens into an anchored regular expression, with a named group per parameter
+func mixedSegment(raw string, tokens []segmentToken) (segment, error) {
+	s := segment{kind: segmentMixed, raw: raw}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, t := range tokens {
+		if t.param == nil {
+			expr.WriteString(regexp.QuoteMeta(t.text))
+			s.literal += len(t.text)
+			continue
+		}
+		// the parameters are anchored by the static text around
+		paramExpr := strings.TrimSuffix(strings.TrimPrefix(t.param.expr, "^"), "$")
+		if paramExpr == "" {
+			paramExpr = ".+"
+		}
+		expr.WriteString("(?P<sprout" + strconv.Itoa(len(s.params)) + ">" + paramExpr + ")")
+		s.params = append(s.params, *t.param)
+	}
+	expr.WriteString("$")
+	exp, err := regexp.Compile(expr.String())
+	if err != nil {
+		return s, errs.Wrap(err, "Invalid regular expression in uri pattern section [{0}]", raw)
+	}
+	s.exp = exp
+	for i := range s.params {
+		s.groups = append(s.groups, exp.SubexpIndex("sprout"+strconv.Itoa(i)))
+	}
+	return s, nil
+}
+
+func (s *segment) match(part string) bool {
+	switch s.kind {
+	case segmentStatic:
+		return part == s.raw
+	case segmentInt:
+		_, err := strconv.ParseInt(part, 10, 64)
+		return err == nil
+	case segmentString:
+		return part != ""
+	case segmentMixed, segmentNamedRegexp, segmentRegexp:
+		return s.exp.MatchString(part)
+	}
+	return true
+}
+
+// capture appends the parameters captured by the matched segment, path is the rest of the request path from the segment
+func (s *segment) capture(part, path string, params *pathParams) {
+	switch s.kind {
+	case segmentMixed:
+		loc := s.exp.FindStringSubmatchIndex(part)
+		for i, p := range s.params {
+			params.list = append(params.list, pathParam{name: p.name, value: part[loc[2*s.groups[i]]:loc[2*s.groups[i]+1]]})
+		}
+	case segmentCatchAll:
+		params.list = append(params.list, pathParam{name: s.name, value: path})
+	default:
+		if s.name != "" {
+			params.list = append(params.list, pathParam{name: s.name, value: part})
+		}
+	}
+}
+
+// precedes tells whether the dynamic segment is tried before the other one
+func (s *segment) precedes(other *segment) bool {
+	if s.kind != other.kind {
+		return s.kind < other.kind
+	}
+	if s.literal != other.literal {
+		return s.literal > other.literal
+	}
+	return s.raw < other.raw
+}
+
+// routeNode is a node of the route tree, which has a level per pattern segment. The static children are
+// looked up by their text, and the dynamic ones are tried in the order of their kinds, backtracking if the
+// rest of the path does not match.
+type routeNode struct {
+	seg      segment
+	static   map[string]*routeNode
+	dynamic  []*routeNode
+	handlers map[string]func(*Context)
+	// the pattern of the endpoints ending at this node
+	pattern string
+}
+
+func (n *routeNode) child(seg segment) *routeNode {
+	if seg.kind == segmentStatic {
+		if child := n.static[seg.raw]; child != nil {
+			return child
+		}
+		child := &routeNode{seg: seg}
+		if n.static == nil {
+			n.static = make(map[string]*routeNode)
+		}
+		n.static[seg.raw] = child
+		return child
+	}
+	for _, child := range n.dynamic {
+		if child.seg.raw == seg.raw {
+			return child
+		}
+	}
+	child := &routeNode{seg: seg}
+	n.dynamic = append(n.dynamic, child)
+	// a total order, so that the routing does not depend on the order of mounting
+	sort.Slice(n.dynamic, func(i, j int) bool {
+		return n.dynamic[i].seg.precedes(&n.dynamic[j].seg)
+	})
+	return child
+}
+
+func (n *routeNode) addHandler(pattern, method string, h func(*Context)) error {
+	method = strings.ToUpper(method)
+	if slices.Lookup(allowedMethods, method, func(left, right string) bool {
+		return left == right
+	}) == -1 {
+		return errs.New("Http method [{0}] not allowed", method)
+	}
+	if _, exists := n.handlers[method]; exists {
+		return errs.New("Duplicate endpoint definitions with the same uri pattern({0}) and method({1})", pattern, method)
+	}
+	if n.handlers == nil {
+		n.handlers = make(map[string]func(*Context))
+	}
+	n.handlers[method] = h
+	if n.pattern == "" {
+		n.pattern = pattern
+	}
+	return nil
+}
+
+// lookup looks up the node of the path with the handler of the method, the path is the rest of the request path
+// without the leading slash. The parameters are captured into params, which is restored if the lookup fails.
+func (n *routeNode) lookup(method, path string, params *pathParams) *routeNode {
+	part, rest := path, ""
+	isLast := true
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		part, rest, isLast = path[:i], path[i+1:], false
+	}
+	if child := n.static[part]; child != nil {
+		if found := child.next(method, rest, isLast, params); found != nil {
+			return found
+		}
+	}
+	for _, child := range n.dynamic {
+		if !child.seg.match(part) {
+			continue
+		}
+		mark := len(params.list)
+		child.seg.capture(part, path, params)
+		// the catch-all segment takes the rest of the path
+		last := isLast || child.seg.kind == segmentCatchAll
+		if found := child.next(method, rest, last, params); found != nil {
+			return found
+		}
+		params.list = params.list[:mark]
+	}
+	return nil
+}
+
+// next goes on with the rest of the path once the segment of the node is matched
+func (n *routeNode) next(method, rest string, last bool, params *pathParams) *routeNode {
+	if last {
+		if n.handlers[method] != nil {
+			return n
+		}
+		return nil
+	}
+	return n.lookup(method, rest, params)
+}
+
+// router routes the requests to the endpoint handlers
+type router struct {
+	root *routeNode
+	// the nodes of the patterns without dynamic segments by path, looked up before the tree
+	static map[string]*routeNode
+}
+
+func newRouter() *router {
+	return &router{
+		root:   &routeNode{pattern: "/"},
+		static: make(map[string]*routeNode),
+	}
+}
+
+func (rt *router) add(pattern, method string, h func(*Context)) error {
+	segs, err := parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+	n := rt.root
+	isStatic := true
+	for _, seg := range segs {
+		isStatic = isStatic && seg.kind == segmentStatic
+		n = n.child(seg)
+	}
+	if err := n.addHandler(pattern, method, h); err != nil {
+		return err
+	}
+	if isStatic {
+		rt.static[normalizePath(pattern)] = n
+	}
+	return nil
+}
+
+// parsePattern parses the sections of the uri pattern, the root pattern "/" has no sections
+func parsePattern(pattern string) ([]segment, error) {
+	path := normalizePath(pattern)
+	if path == "" {
+		return nil, nil
+	}
+	raws := strings.Split(path, "/")
+	segs := make([]segment, len(raws))
+	for i, raw := range raws {
+		seg, err := parseSegment(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, err
+		}
+		if seg.kind == segmentCatchAll && i < len(raws)-1 {
+			return nil, errs.New("The catch-all section [{0}] should be the last one of uri pattern [{1}]", raw, pattern)
+		}
+		segs[i] = seg
+	}
+	return segs, nil
+}
+
+// route finds the handler of the request path, the path parameters are captured into params
+func (rt *router) route(method, path string, params *pathParams) (*routeNode, bool) {
+	path = normalizePath(path)
+	if n := rt.static[path]; n != nil && n.handlers[method] != nil {
+		return n, true
+	}
+	if path == "" {
+		return nil, false
+	}
+	n := rt.root.lookup(method, path, params)
+	return n, n != nil
+}
+
+// allowed returns the methods of the endpoints matching the path in the order of allowedMethods, including the HEAD
+// and OPTIONS answered by the mux. It returns nil if the path matches no endpoint.
+func (rt *router) allowed(path string) []string {
+	path = normalizePath(path)
+	set := make(map[string]bool)
+	if n := rt.static[path]; n != nil {
+		n.collectMethods(set)
+	}
+	if path != "" {
+		rt.root.methods(path, set)
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	if set[http.MethodGet] {
+		set[http.MethodHead] = true
+	}
+	set[http.MethodOptions] = true
+	var methods []string
+	for _, m := range allowedMethods {
+		if set[m] {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// methods collects the methods of all the endpoints matching the path, unlike lookup it does not stop at the first one
+func (n *routeNode) methods(path string, set map[string]bool) {
+	part, rest := path, ""
+	isLast := true
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		part, rest, isLast = path[:i], path[i+1:], false
+	}
+	children := n.dynamic
+	if child := n.static[part]; child != nil {
+		children = append([]*routeNode{child}, children...)
+	}
+	for _, child := range children {
+		if !child.seg.match(part) {
+			continue
+		}
+		if isLast || child.seg.kind == segmentCatchAll {
+			child.collectMethods(set)
+		} else {
+			child.methods(rest, set)
+		}
+	}
+}
+
+func (n *routeNode) collectMethods(set map[string]bool) {
+	for m := range n.handlers {
+		set[m] = true
+	}
+}
+
+// normalizePath trims the leading slash and squeezes the double slashes
+func normalizePath(path string) string {
+	path = strings.TrimSpace(path)
+	// every pass halves the runs of slashes, eg. /// turns into //
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+	return strings.TrimPrefix(path, "/")
+}
+
+type pathParam struct {
+	name  string
+	value string
+}
+
+// pathParams are the path parameters of a request, pooled to capture the parameters without allocations.
+// They are released once the request is handled, and should not be used by the goroutines outliving it.
+type pathParams struct {
+	list []pathParam
+}
+
+var pathParamsPool = sync.Pool{
+	New: func() any {
+		return &pathParams{list: make([]pathParam, 0, 8)}
+	},
+}
+
+func acquirePathParams() *pathParams {
+	return pathParamsPool.Get().(*pathParams)
+}
+
+func releasePathParams(p *pathParams) {
+	p.list = p.list[:0]
+	pathParamsPool.Put(p)
+}
+
+// get returns the value of the named parameter, the last one wins if the name is captured more than once
+func (p *pathParams) get(name string) (string, bool) {
+	for i := len(p.list) - 1; i >= 0; i-- {
+		if p.list[i].name == name {
+			return p.list[i].value, true
+		}
+	}
+	return "", false
+}
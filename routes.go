@@ -0,0 +1,189 @@
+package sprout
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Route describes an endpoint mounted on the server, one per method
+type Route struct {
+	Name    string
+	Method  string
+	Pattern string
+	// kinds of the pattern sections: static, mixed, %d, %s, named-regexp, regexp, named, any and catch-all
+	Sections []string
+	// interceptors wrapping the endpoint, outermost first, named after their functions
+	Interceptors []string
+	Input        reflect.Type
+	// type of the response body, or of the events of the SSE endpoints, nil for the WebSocket endpoints
+	Output reflect.Type
+}
+
+func (r Route) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name         string   `json:"name"`
+		Method       string   `json:"method"`
+		Pattern      string   `json:"pattern"`
+		Sections     []string `json:"sections"`
+		Interceptors []string `json:"interceptors"`
+		Input        string   `json:"input"`
+		Output       string   `json:"output,omitempty"`
+	}{r.Name, r.Method, r.Pattern, r.Sections, r.Interceptors, typeName(r.Input), typeName(r.Output)})
+}
+
+// Routes lists the endpoints mounted on the server in the order of mounting, the built-in ones like the
+// OpenAPI document are not included
+func (s *Server) Routes() []Route {
+	var routes []Route
+	for _, ep := range s.endpoints {
+		var sections []string
+		segs, _ := parsePattern(ep.pattern)
+		for _, seg := range segs {
+			sections = append(sections, seg.kind.String())
+		}
+		for _, method := range ep.methods {
+			routes = append(routes, Route{
+				Name:         ep.name,
+				Method:       method,
+				Pattern:      ep.pattern,
+				Sections:     sections,
+				Interceptors: ep.interceptors,
+				Input:        ep.inputType,
+				Output:       ep.outputType,
+			})
+		}
+	}
+	return routes
+}
+
+func routesHandler(routes []Route) func(*Context) {
+	raw, err := json.Marshal(routes)
+	return func(ctx *Context) {
+		if err != nil {
+			defaultErrHandler(ctx, err)
+			return
+		}
+		ctx.Writer.Header().Set("Content-Type", MimeJson)
+		ctx.Writer.Write(raw)
+	}
+}
+
+// routeTable renders the routes as a table, which is printed at startup in Debug mode
+func routeTable(routes []Route) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATTERN\tNAME\tINPUT\tOUTPUT\tINTERCEPTORS")
+	for _, r := range routes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Method, r.Pattern, r.Name, typeName(r.Input), typeName(r.Output),
+			strings.Join(r.Interceptors, ", "))
+	}
+	w.Flush()
+	return b.String()
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+// interceptorNames names the interceptors after their functions, eg. sprout.recoverInterceptor
+func interceptorNames(ics []Interceptor) []string {
+	names := make([]string, len(ics))
+	for i, ic := range ics {
+		name := "unknown"
+		if fn := runtime.FuncForPC(reflect.ValueOf(ic).Pointer()); fn != nil {
+			name = fn.Name()
+		}
+		name = name[strings.LastIndexByte(name, '/')+1:]
+		// the interceptors made by the constructors are their closures, eg. sprout.newCorsInterceptor.func1
+		for {
+			j := strings.LastIndex(name, ".func")
+			if j < 0 || strings.Trim(name[j+len(".func"):], "0123456789") != "" {
+				break
+			}
+			name = name[:j]
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// ambiguousRoutes finds the routes of the same method whose sections are of the same weight at every level, so that
+// they may match the same paths, eg. /users/{id} and /users/{name}, or /users/%d and /users/{id:~\d+}. The paths
+// matching both are routed to the first route of each pair, which precedes the other one in the router.
+func ambiguousRoutes(routes []Route) [][2]Route {
+	type weighed struct {
+		route Route
+		segs  []segment
+	}
+	groups := make(map[string][]weighed)
+	var keys []string
+	for _, r := range routes {
+		segs, err := parsePattern(r.Pattern)
+		if err != nil {
+			continue
+		}
+		weights := make([]string, len(segs))
+		for i := range segs {
+			weights[i] = segs[i].weight()
+		}
+		key := r.Method + " /" + strings.Join(weights, "/")
+		if _, exists := groups[key]; !exists {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], weighed{r, segs})
+	}
+	var pairs [][2]Route
+	for _, key := range keys {
+		group := groups[key]
+		// the order of the router, level by level
+		sort.SliceStable(group, func(i, j int) bool {
+			for k := range group[i].segs {
+				if group[i].segs[k].raw != group[j].segs[k].raw {
+					return group[i].segs[k].precedes(&group[j].segs[k])
+				}
+			}
+			return false
+		})
+		for _, other := range group[1:] {
+			if other.route.Pattern != group[0].route.Pattern {
+				pairs = append(pairs, [2]Route{group[0].route, other.route})
+			}
+		}
+	}
+	return pairs
+}
+
+// weight is the segment without the parameter names and the regular expressions. The static segments weigh their
+// text, and the dynamic ones of the same weight may match the same text: the ones matching some of the text (%d,
+// {name:~regex} and ~regex), the ones matching any text (%s, {name} and *), the catch-all ones, and the mixed ones
+// of the same static text.
+func (s *segment) weight() string {
+	switch s.kind {
+	case segmentStatic:
+		return s.raw
+	case segmentInt, segmentNamedRegexp, segmentRegexp:
+		return "{~}"
+	case segmentString, segmentNamed, segmentAny:
+		return "{}"
+	case segmentMixed:
+		tokens, _ := splitSegment(s.raw)
+		var b strings.Builder
+		for _, t := range tokens {
+			if t.param == nil {
+				b.WriteString(t.text)
+			} else {
+				b.WriteString("{}")
+			}
+		}
+		return b.String()
+	}
+	return "{...}"
+}
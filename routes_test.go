@@ -0,0 +1,188 @@
+package sprout
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type routesTestInput struct {
+	Id int `path:"id"`
+}
+
+func routesTestInterceptor(next func(*Context) error) func(*Context) error {
+	return next
+}
+
+func newRoutesTestServer(t *testing.T) *Server {
+	t.Helper()
+	svr := newDefaultServer("test")
+	svr.Interceptors = []Interceptor{routesTestInterceptor}
+	g := &Group{Prefix: "/api", Interceptors: []Interceptor{recordingInterceptor(new([]string), "api")}}
+	g.Mount(&Endpoint[routesTestInput, string]{
+		Name:    "user",
+		Pattern: "/users/%d/{name:~[a-z]+}/{path...}",
+		Methods: []string{http.MethodGet, http.MethodPut},
+		Handler: func(ctx *Context, in routesTestInput) (string, error) { return "", nil },
+	})
+	if err := g.mountTo(svr, nil); err != nil {
+		t.Fatal(err)
+	}
+	mountTestEndpoints(t, svr, &SSEEndpoint[routesTestInput, int]{
+		Name:    "ticks",
+		Pattern: "/ticks",
+		Handler: func(ctx *Context, in routesTestInput, sink *EventSink[int]) error { return nil },
+	}, &WebSocketEndpoint[routesTestInput, string]{
+		Name:    "chat",
+		Pattern: "/chat/v{version:~\\d+}",
+		Handler: func(ctx *Context, in routesTestInput, conn *WebSocketConn[string]) error { return nil },
+	})
+	return svr
+}
+
+func TestServerRoutes(t *testing.T) {
+	routes := newRoutesTestServer(t).Routes()
+	input := reflect.TypeOf(routesTestInput{})
+	for i, expected := range []Route{
+		{"user", http.MethodGet, "/api/users/%d/{name:~[a-z]+}/{path...}", []string{"static", "static", "%d", "named-regexp", "catch-all"}, nil, input, reflect.TypeOf("")},
+		{"user", http.MethodPut, "/api/users/%d/{name:~[a-z]+}/{path...}", []string{"static", "static", "%d", "named-regexp", "catch-all"}, nil, input, reflect.TypeOf("")},
+		{"ticks", http.MethodGet, "/ticks", []string{"static"}, nil, input, reflect.TypeOf(0)},
+		{"chat", http.MethodGet, "/chat/v{version:~\\d+}", []string{"static", "mixed"}, nil, input, nil},
+	} {
+		if i >= len(routes) {
+			t.Fatalf("expected %d routes, got %d", i+1, len(routes))
+		}
+		r := routes[i]
+		if r.Name != expected.Name || r.Method != expected.Method || r.Pattern != expected.Pattern ||
+			!slices.Equal(r.Sections, expected.Sections) || r.Input != expected.Input || r.Output != expected.Output {
+			t.Errorf("expected the route %+v, got %+v", expected, r)
+		}
+	}
+	if len(routes) != 4 {
+		t.Errorf("expected 4 routes, got %d", len(routes))
+	}
+
+	// the built-in interceptors, then the ones of the server and the group
+	for _, r := range routes {
+		expected := []string{"sprout.routesTestInterceptor"}
+		if r.Name == "user" {
+			expected = append(expected, "sprout.recordingInterceptor")
+		}
+		if len(r.Interceptors) < len(expected) || r.Interceptors[0] != "sprout.recoverInterceptor" ||
+			!slices.Equal(r.Interceptors[len(r.Interceptors)-len(expected):], expected) {
+			t.Errorf("%s: unexpected interceptors %v", r.Name, r.Interceptors)
+		}
+	}
+}
+
+func TestRouteTable(t *testing.T) {
+	table := routeTable(newRoutesTestServer(t).Routes())
+	lines := strings.Split(strings.TrimSuffix(table, "\n"), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "METHOD") {
+		t.Fatalf("unexpected table\n%s", table)
+	}
+	for i, expected := range [][]string{
+		{"GET", "/api/users/%d/{name:~[a-z]+}/{path...}", "user", "sprout.routesTestInput", "string", "sprout.routesTestInterceptor, sprout.recordingInterceptor"},
+		{"PUT", "/api/users/%d/{name:~[a-z]+}/{path...}", "user"},
+		{"GET", "/ticks", "ticks", "sprout.routesTestInput", "int"},
+		{"GET", "/chat/v{version:~\\d+}", "chat", "sprout.routesTestInput", "sprout.recoverInterceptor"},
+	} {
+		fields := strings.Fields(lines[i+1])
+		if len(fields) < len(expected) || !slices.Equal(fields[:len(expected)-1], expected[:len(expected)-1]) ||
+			!strings.Contains(lines[i+1], expected[len(expected)-1]) {
+			t.Errorf("expected the row %v, got %q", expected, lines[i+1])
+		}
+	}
+}
+
+func TestInterceptorNames(t *testing.T) {
+	names := interceptorNames([]Interceptor{recoverInterceptor, routesTestInterceptor, recordingInterceptor(new([]string), "x"),
+		func(next func(*Context) error) func(*Context) error { return next }})
+	expected := []string{"sprout.recoverInterceptor", "sprout.routesTestInterceptor", "sprout.recordingInterceptor", "sprout.TestInterceptorNames"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestDebugRoutes(t *testing.T) {
+	for _, c := range []struct {
+		debug  bool
+		path   string
+		status int
+	}{
+		{true, "/debug/routes", http.StatusOK},
+		{false, "/debug/routes", http.StatusNotFound},
+		{true, "", http.StatusNotFound},
+	} {
+		svr := newRoutesTestServer(t)
+		svr.Debug, svr.DebugRoutesPath = c.debug, c.path
+		mx, err := svr.buildMux()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := serve(mx, httptest.NewRequest(http.MethodGet, "/debug/routes", nil))
+		if w.Code != c.status {
+			t.Errorf("debug %t, path %q: expected %d, got %d", c.debug, c.path, c.status, w.Code)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var routes []struct {
+			Name         string   `json:"name"`
+			Method       string   `json:"method"`
+			Sections     []string `json:"sections"`
+			Interceptors []string `json:"interceptors"`
+			Input        string   `json:"input"`
+			Output       *string  `json:"output"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil {
+			t.Fatal(err)
+		}
+		// the route list itself is not listed
+		if len(routes) != 4 || routes[0].Name != "user" || routes[0].Input != "sprout.routesTestInput" ||
+			routes[0].Output == nil || *routes[0].Output != "string" || len(routes[0].Sections) != 5 || len(routes[0].Interceptors) == 0 {
+			t.Errorf("unexpected routes %s", w.Body.String())
+		} else if routes[3].Name != "chat" || routes[3].Output != nil {
+			t.Errorf("expected no output of the WebSocket endpoint, got %s", w.Body.String())
+		}
+	}
+
+	// the route list may not take the path of an endpoint
+	svr := newRoutesTestServer(t)
+	svr.Debug, svr.DebugRoutesPath = true, "/ticks"
+	if _, err := svr.buildMux(); err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Errorf("expected the conflict to be reported, got %v", err)
+	}
+}
+
+func TestAmbiguousRoutes(t *testing.T) {
+	var routes []Route
+	for _, pattern := range []string{
+		"/users/{name}", "/users/{id}", "/users/%d", "/users/{id:~\\d+}", "/u/{a:~\\d+}", "/u/{b:~[0-9]+}",
+		"/files/*", "/files/%s", "/v{a}/x", "/v{b}/x", "/w{c}/x", "/static/{path...}", "/static/**",
+		"/orders/%d/items", "/orders/{id}/items", "/orders/%d/tags",
+	} {
+		routes = append(routes, Route{Method: http.MethodGet, Pattern: pattern})
+	}
+	routes = append(routes, Route{Method: http.MethodDelete, Pattern: "/users/{key}"})
+	var found []string
+	for _, pair := range ambiguousRoutes(routes) {
+		found = append(found, pair[0].Pattern+" "+pair[1].Pattern)
+	}
+	expected := []string{
+		"/users/{id} /users/{name}",
+		"/users/%d /users/{id:~\\d+}",
+		"/u/{a:~\\d+} /u/{b:~[0-9]+}",
+		"/files/%s /files/*",
+		"/v{a}/x /v{b}/x",
+		"/static/** /static/{path...}",
+	}
+	if !slices.Equal(found, expected) {
+		t.Errorf("expected %q, got %q", expected, found)
+	}
+}
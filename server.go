@@ -2,35 +2,79 @@ package sprout
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
-	"os/signal"
 	"reflect"
+	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/quic-go/quic-go/http3"
+	"github.com/wxy365/basal/errs"
 	"github.com/wxy365/basal/log"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 )
 
 type Server struct {
-	Name            string
-	Port            uint16
-	CertFile        string
-	KeyFile         string
+	Name     string
+	Port     uint16
+	CertFile string
+	KeyFile  string
+	// TLS mode of the server, only works with CertFile and KeyFile set, TLSModeBoth is used if empty
+	TLSMode         string
 	Debug           bool
 	ShutdownTimeout time.Duration
+	// the path serving the OpenAPI document of the server, the document is not served if empty
+	OpenAPIPath string
+	// the path serving the docs UI of the OpenAPI document, it only works with OpenAPIPath set
+	DocsPath string
+	// the path listing the routes of the server in JSON, it is only served in Debug mode
+	DebugRoutesPath string
+	// the version of the API, shown in the OpenAPI document
+	APIVersion string
 
-	Validators   []Validator
-	ErrorHandler ErrorHandler
+	// serializers and deserializers of this server by media type, they take precedence over
+	// the ones registered by RegisterSerializer and RegisterDeserializer
+	Serializers   map[string]Serializer
+	Deserializers map[string]Deserializer
 
-	endpoints []*refinedEndpoint
+	// max size of a file uploaded in a multipart form, DefaultMaxUploadFileBytes is used if zero
+	MaxUploadFileBytes int64
+	// max size of a multipart form body, DefaultMaxUploadBytes is used if zero
+	MaxUploadBytes int64
+
+	// negotiation of the request locales, which decides the language of the messages
+	Locale LocaleConfig
+
+	Validators []Validator
+	// whether to report all the invalid fields of the inputs, ValidationFailFast is used if not set
+	ValidationMode ValidationMode
+	ErrorHandler   ErrorHandler
+	// interceptors applied to every endpoint of the server, they run after the built-in interceptors
+	// and before the interceptors of groups and endpoints
+	Interceptors []Interceptor
+
+	endpoints  []*refinedEndpoint
+	httpServer *http.Server
+	listener   net.Listener
+	h3Server   *http3.Server
+	packetConn net.PacketConn
 }
 
+const (
+	// TLSModeBoth serves HTTP/1.1 and HTTP/2 over TCP, and HTTP/3 over QUIC on the same port,
+	// HTTP/3 is advertised to the TCP clients through the Alt-Svc header
+	TLSModeBoth = "both"
+	// TLSModeH3 serves HTTP/3 over QUIC only
+	TLSModeH3 = "h3"
+	// TLSModeTCP serves HTTP/1.1 and HTTP/2 over TCP only
+	TLSModeTCP = "tcp"
+)
+
 func newDefaultServer(name string) *Server {
 	return &Server{
 		Name:            name,
@@ -41,74 +85,141 @@ func newDefaultServer(name string) *Server {
 	}
 }
 
-func (s *Server) start() {
-	mx := s.buildMux()
-
-	// set up signal handling before starting the server
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-
+// prepare builds the route mux and the underlying http servers, it must be called before listen
+func (s *Server) prepare() error {
+	mx, err := s.buildMux()
+	if err != nil {
+		return errs.Wrap(err, "Failed to build the route mux of server [{0}]", s.Name)
+	}
 	if s.CertFile == "" || s.KeyFile == "" {
 		if s.Port == 0 {
 			s.Port = 80
 		}
-		server := &http.Server{
+		s.httpServer = &http.Server{
 			Addr:    fmt.Sprintf(":%d", s.Port),
 			Handler: h2c.NewHandler(mx, &http2.Server{}),
 		}
+		return nil
+	}
 
-		go func() {
-			<-quit
-			fmt.Printf("'%s' is shutting down\n", s.Name)
-			ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
-			defer cancel()
-			if err := server.Shutdown(ctx); err != nil {
-				log.PanicErrF("Failed to shutdown server gracefully", err)
-			}
-		}()
-
-		fmt.Printf("'%s' is started on port: %d\n", s.Name, s.Port)
-		err := server.ListenAndServe()
-		if err != nil && err != http.ErrServerClosed {
-			log.PanicErr(err)
+	if s.Port == 0 {
+		s.Port = 443
+	}
+	if s.TLSMode == "" {
+		s.TLSMode = TLSModeBoth
+	}
+	if s.TLSMode != TLSModeBoth && s.TLSMode != TLSModeH3 && s.TLSMode != TLSModeTCP {
+		return errs.New("Invalid TLS mode [{0}] of server [{1}]", s.TLSMode, s.Name)
+	}
+	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return errs.Wrap(err, "Failed to load the certificate of server [{0}]", s.Name)
+	}
+	addr := fmt.Sprintf(":%d", s.Port)
+	if s.TLSMode != TLSModeTCP {
+		s.h3Server = &http3.Server{
+			Addr:      addr,
+			Handler:   mx,
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
 		}
-	} else {
-		if s.Port == 0 {
-			s.Port = 443
+	}
+	if s.TLSMode != TLSModeH3 {
+		var handler http.Handler = mx
+		if s.h3Server != nil {
+			// advertise HTTP/3 to the clients connected through TCP
+			handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = s.h3Server.SetQUICHeaders(w.Header())
+				mx.ServeHTTP(w, r)
+			})
+		}
+		s.httpServer = &http.Server{
+			Addr:      addr,
+			Handler:   handler,
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
 		}
-		server := http3.Server{
-			Addr: fmt.Sprintf(":%d", s.Port),
+	}
+	return nil
+}
+
+// listen opens the network listeners of the server, the TCP and the UDP listeners share the same port
+func (s *Server) listen() error {
+	var err error
+	if s.httpServer != nil {
+		s.listener, err = net.Listen("tcp", s.httpServer.Addr)
+		if err != nil {
+			return errs.Wrap(err, "Server [{0}] failed to listen on port: {1}", s.Name, s.Port)
 		}
+	}
+	if s.h3Server != nil {
+		s.packetConn, err = net.ListenPacket("udp", s.h3Server.Addr)
+		if err != nil {
+			if s.listener != nil {
+				s.listener.Close()
+			}
+			return errs.Wrap(err, "Server [{0}] failed to listen on port: {1}", s.Name, s.Port)
+		}
+	}
+	fmt.Printf("'%s' is started on port: %d\n", s.Name, s.Port)
+	return nil
+}
 
+// serve blocks until the server is shut down or any of the underlying servers fails,
+// http.ErrServerClosed is not reported
+func (s *Server) serve() error {
+	results := make(chan error, 2)
+	var n int
+	if s.h3Server != nil {
+		n++
 		go func() {
-			<-quit
-			fmt.Printf("'%s' is shutting down\n", s.Name)
-			ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
-			defer cancel()
-			if err := server.Shutdown(ctx); err != nil {
-				log.PanicErrF("Failed to shutdown server gracefully", err)
+			results <- s.h3Server.Serve(s.packetConn)
+		}()
+	}
+	if s.httpServer != nil {
+		n++
+		go func() {
+			if s.httpServer.TLSConfig != nil {
+				// HTTP/2 is enabled automatically over TLS
+				results <- s.httpServer.ServeTLS(s.listener, "", "")
+			} else {
+				results <- s.httpServer.Serve(s.listener)
 			}
 		}()
-
-		fmt.Printf("'%s' is started on port: %d\n", s.Name, s.Port)
-		err := server.ListenAndServeTLS(s.CertFile, s.KeyFile)
-		if err != nil && err != http.ErrServerClosed {
-			log.PanicErr(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := <-results; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
 		}
 	}
+	return nil
+}
+
+// shutdown stops accepting new connections and waits for the in-flight requests within the ShutdownTimeout
+func (s *Server) shutdown(ctx context.Context) error {
+	fmt.Printf("'%s' is shutting down\n", s.Name)
+	ctx, cancel := context.WithTimeout(ctx, s.ShutdownTimeout)
+	defer cancel()
+	var errList []error
+	if s.h3Server != nil {
+		errList = append(errList, s.h3Server.Shutdown(ctx))
+		// the http3 server does not close the connection it serves
+		s.packetConn.Close()
+	}
+	if s.httpServer != nil {
+		errList = append(errList, s.httpServer.Shutdown(ctx))
+		// the listener is not tracked by the http server if it has never been served
+		s.listener.Close()
+	}
+	return errors.Join(errList...)
 }
 
-func (s *Server) buildMux() *mux {
+func (s *Server) buildMux() (*mux, error) {
 	handlers := make(map[epSig]func(*Context))
+	fixedMedia := make(map[epSig]string)
 	for _, ep := range s.endpoints {
 		h := func(ctx *Context) {
 			err := ep.httpHandler(ctx)
 			if err != nil {
-				serializer := ctx.Value(ctxKeySerializer).(Serializer)
-				err = serializer(err, ctx.Writer)
-				if err != nil {
-					log.ErrorErrF("Failed to serialize error message", err)
-				}
+				defaultErrHandler(ctx, err)
 			}
 		}
 
@@ -118,9 +229,51 @@ func (s *Server) buildMux() *mux {
 				pattern: ep.pattern,
 			}
 			handlers[sig] = h
+			if ep.outputMime != "" || ep.websocket {
+				fixedMedia[sig] = ep.outputMime
+			}
+		}
+	}
+	apiHandlers, err := s.openAPIHandlers()
+	if err != nil {
+		return nil, err
+	}
+	for sig, h := range apiHandlers {
+		if _, exists := handlers[sig]; exists {
+			return nil, errs.New("The path [{0}] of the OpenAPI document conflicts with the endpoints of server [{1}]", sig.pattern, s.Name)
 		}
+		handlers[sig] = h
+	}
+	routes := s.Routes()
+	if s.Debug && s.DebugRoutesPath != "" {
+		sig := epSig{method: http.MethodGet, pattern: s.DebugRoutesPath}
+		if _, exists := handlers[sig]; exists {
+			return nil, errs.New("The path [{0}] of the route list conflicts with the endpoints of server [{1}]", sig.pattern, s.Name)
+		}
+		handlers[sig] = routesHandler(routes)
+	}
+	for _, pair := range ambiguousRoutes(routes) {
+		log.Warn("The routes [{0} {1}] and [{2} {3}] of server [{4}] may match the same paths, which are routed to the former",
+			pair[0].Method, pair[0].Pattern, pair[1].Method, pair[1].Pattern, s.Name)
+	}
+	media, err := newMediaTypes(s.Serializers, s.Deserializers)
+	if err != nil {
+		return nil, err
+	}
+	locales, err := newLocaleNegotiator(s.Locale)
+	if err != nil {
+		return nil, errs.Wrap(err, "Invalid locale config of server [{0}]", s.Name)
 	}
-	return newMux(handlers)
+	mx, err := newMux(handlers)
+	if err != nil {
+		return nil, err
+	}
+	mx.media, mx.locales, mx.fixedMedia = media, locales, fixedMedia
+	if s.Debug {
+		fmt.Printf("Routes of '%s':\n%s", s.Name, routeTable(routes))
+	}
+	mx.maxUploadFileBytes, mx.maxUploadBytes = s.MaxUploadFileBytes, s.MaxUploadBytes
+	return mx, nil
 }
 
 type epSig struct {
@@ -128,72 +281,125 @@ type epSig struct {
 	pattern string
 }
 
-func (s *Server) buildInputEntityValidateFuncs(inputType reflect.Type) ObjectValidateFunc {
-	fieldVdFuncs := make([]ValidateFunc, inputType.NumField())
-	for i := 0; i < inputType.NumField(); i++ {
-		f := inputType.Field(i)
-		validateTag := f.Tag.Get("validate")
-		validateTag = strings.TrimSpace(validateTag)
-		if validateTag != "" {
-			for _, v := range s.Validators {
-				if vdFunc := v.ValidateFunc(validateTag, i, inputType); vdFunc != nil {
-					if fieldVdFuncs[i] == nil {
-						fieldVdFuncs[i] = vdFunc
-					} else {
-						fvdFunc := fieldVdFuncs[i]
-						fieldVdFuncs[i] = func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
-							err := fvdFunc(ctx, fieldIdx, struValue)
-							if err != nil {
-								return err
-							}
-							return vdFunc(ctx, fieldIdx, struValue)
-						}
-					}
-				}
+// buildValidateFuncs builds the validate function of the endpoint input, the validators report invalid
+// validate tags by panicking, which is turned into an error here
+func (s *Server) buildValidateFuncs(endpointName string, inputType reflect.Type, mode ValidationMode) (vf ObjectValidateFunc, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = errs.Wrap(e, "Invalid validate tags of endpoint [{0}]", endpointName)
+			} else {
+				err = errs.New("Invalid validate tags of endpoint [{0}]: {1}", endpointName, r)
 			}
 		}
+	}()
+	if mode == ValidationDefault {
+		mode = s.ValidationMode
+	}
+	sv := s.buildStructValidator(inputType, make(map[reflect.Type]*structValidator))
+	return func(ctx context.Context, obj reflect.Value) error {
+		var fieldErrs ValidationErrors
+		sv.validate(ctx, obj, "", mode == ValidationAggregate, &fieldErrs)
+		if len(fieldErrs) == 0 {
+			return nil
+		}
+		return errs.I18nWrap(ctx, "sprout.params.invalid", fieldErrs).WithStatus(http.StatusBadRequest)
+	}, nil
+}
 
-		fieldType := f.Type
-		for fieldType.Kind() == reflect.Pointer {
-			fieldType = fieldType.Elem()
-		}
-		if fieldType.Kind() == reflect.Struct {
-			nestVdFunc := s.buildInputEntityValidateFuncs(fieldType)
-			if nestVdFunc != nil {
-				if fieldVdFuncs[i] == nil {
-					fieldVdFuncs[i] = func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
-						return nestVdFunc(ctx, struValue.Field(fieldIdx))
-					}
-				} else {
-					fvdFunc := fieldVdFuncs[i]
-					fieldVdFuncs[i] = func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
-						err := fvdFunc(ctx, fieldIdx, struValue)
-						if err != nil {
-							return err
-						}
-						return nestVdFunc(ctx, struValue.Field(fieldIdx))
-					}
-				}
-			}
+// buildStructValidator builds the validators of the fields of the struct type, including the nested structs
+// and the elements of the collections. The validators being built are kept in built, so that recursive types
+// refer to their own validators.
+func (s *Server) buildStructValidator(struType reflect.Type, built map[reflect.Type]*structValidator) *structValidator {
+	sv := &structValidator{self: reflect.PointerTo(struType).Implements(typeValidatable)}
+	built[struType] = sv
+	for i := 0; i < struType.NumField(); i++ {
+		f := struType.Field(i)
+		fv := s.buildFieldValidator(struType, i, strings.TrimSpace(f.Tag.Get("validate")), built)
+		if !fv.empty() {
+			fv.name = validationFieldName(f)
+			sv.fields = append(sv.fields, fv)
 		}
 	}
-	if len(fieldVdFuncs) == 0 {
-		return nil
+	return sv
+}
+
+// buildFieldValidator builds the validators of a field with the validate tag, the rules after dive
+// apply to the elements of the slice, array or map field
+func (s *Server) buildFieldValidator(struType reflect.Type, idx int, validateTag string, built map[reflect.Type]*structValidator) fieldValidator {
+	f := struType.Field(idx)
+	fieldTag, elemTag, dive := splitDiveTag(validateTag)
+	fv := fieldValidator{idx: idx}
+	if strings.TrimSpace(fieldTag) != "" {
+		for _, v := range s.Validators {
+			if vdFunc := v.ValidateFunc(fieldTag, idx, struType); vdFunc != nil {
+				fv.funcs = append(fv.funcs, vdFunc)
+			}
+		}
 	}
-	return func(ctx context.Context, obj reflect.Value) error {
-		for obj.Kind() == reflect.Pointer {
-			obj = obj.Elem()
-		}
-		for i := 0; i < obj.NumField(); i++ {
-			if fieldVdFuncs[i] != nil {
-				err := fieldVdFuncs[i](ctx, i, obj)
-				if err != nil {
-					return err
-				}
+
+	fieldType := derefType(f.Type)
+	switch fieldType.Kind() {
+	case reflect.Struct:
+		if fieldType != typeTime {
+			// the validator of a recursive type may be still being built, keep it anyway
+			nested, exists := built[fieldType]
+			if !exists {
+				nested = s.buildStructValidator(fieldType, built)
 			}
+			if exists || !nested.empty() {
+				fv.nested = nested
+			}
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if f.IsExported() {
+			fv.elem = s.buildElemValidator(f, fieldType, elemTag, built)
+		}
+		dive = false
+	}
+	if dive {
+		panic(errs.New("The dive rule of {0}.{1} only applies to slices, arrays and maps", struType.Name(), f.Name))
+	}
+	return fv
+}
+
+// buildElemValidator builds the validator of the elements of the collection type, the rules of the map keys
+// are enclosed by keys and endkeys, eg. dive;keys;[1,16];endkeys;required. Nil is returned if there is nothing
+// to validate.
+func (s *Server) buildElemValidator(f reflect.StructField, collType reflect.Type, elemTag string, built map[reflect.Type]*structValidator) *elemValidator {
+	keyTag, valueTag, err := splitKeysTag(elemTag)
+	if err != nil {
+		panic(err)
+	}
+	ev := &elemValidator{
+		holder: elemHolderType(f, collType.Elem(), valueTag),
+	}
+	ev.field = s.buildFieldValidator(ev.holder, 0, strings.TrimSpace(valueTag), built)
+	if strings.TrimSpace(keyTag) != "" {
+		if collType.Kind() != reflect.Map {
+			panic(errs.New("The keys rule of [{0}] only applies to maps", f.Name))
 		}
+		key := &elemValidator{holder: elemHolderType(f, collType.Key(), keyTag)}
+		key.field = s.buildFieldValidator(key.holder, 0, strings.TrimSpace(keyTag), built)
+		ev.key = key
+	}
+	if ev.field.empty() && ev.key == nil {
 		return nil
 	}
+	return ev
+}
+
+// elemHolderType returns the struct type holding an element, named and labeled after the collection field
+func elemHolderType(f reflect.StructField, elemType reflect.Type, validateTag string) reflect.Type {
+	tag := `validate:` + strconv.Quote(validateTag)
+	if label := f.Tag.Get("label"); label != "" {
+		tag += ` label:` + strconv.Quote(label)
+	}
+	return reflect.StructOf([]reflect.StructField{{
+		Name: f.Name,
+		Type: elemType,
+		Tag:  reflect.StructTag(tag),
+	}})
 }
 
 type svrCfg struct {
@@ -201,6 +407,15 @@ type svrCfg struct {
 	Port            uint16 `map:"port"`
 	CertFile        string `map:"cert_file"`
 	KeyFile         string `map:"key_file"`
+	TLSMode         string `map:"tls_mode"`
 	Debug           *bool  `map:"debug"`
 	ShutdownTimeout uint64 `map:"shutdown_timeout"` // in milliseconds
+	OpenAPIPath     string `map:"openapi_path"`
+	DocsPath        string `map:"docs_path"`
+	DebugRoutesPath string `map:"debug_routes_path"`
+	APIVersion      string `map:"api_version"`
+	// upload limits in bytes
+	MaxUploadFileBytes int64  `map:"max_upload_file_bytes"`
+	MaxUploadBytes     int64  `map:"max_upload_bytes"`
+	DefaultLocale      string `map:"default_locale"`
 }
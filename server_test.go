@@ -0,0 +1,176 @@
+package sprout
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// writeTestCert writes a self-signed certificate of localhost and its key to temp files
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func newTLSTestServer(t *testing.T, tlsMode string) *Server {
+	t.Helper()
+	svr := newDefaultServer("test")
+	svr.CertFile, svr.KeyFile = writeTestCert(t)
+	svr.TLSMode = tlsMode
+	svr.Port = freePort(t)
+	mountTestEndpoints(t, svr, &Endpoint[appTestInput, string]{
+		Name:    "hello",
+		Pattern: "/hello",
+		Methods: []string{http.MethodGet},
+		Handler: func(ctx *Context, in appTestInput) (string, error) { return ctx.Request.Proto, nil },
+	})
+	return svr
+}
+
+func TestServerTLSMode(t *testing.T) {
+	for _, c := range []struct {
+		mode       string
+		tcp, quic  bool
+		invalid    bool
+		expectMode string
+	}{
+		{"", true, true, false, TLSModeBoth},
+		{TLSModeBoth, true, true, false, TLSModeBoth},
+		{TLSModeH3, false, true, false, TLSModeH3},
+		{TLSModeTCP, true, false, false, TLSModeTCP},
+		{"quic", false, false, true, ""},
+	} {
+		svr := newTLSTestServer(t, c.mode)
+		err := svr.prepare()
+		if c.invalid {
+			if err == nil || !strings.Contains(err.Error(), "Invalid TLS mode") {
+				t.Errorf("%q: expected the TLS mode to be rejected, got %v", c.mode, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.mode, err)
+			continue
+		}
+		if svr.TLSMode != c.expectMode || (svr.httpServer != nil) != c.tcp || (svr.h3Server != nil) != c.quic {
+			t.Errorf("%q: expected the mode %s with tcp %t and quic %t, got %s with tcp %t and quic %t", c.mode,
+				c.expectMode, c.tcp, c.quic, svr.TLSMode, svr.httpServer != nil, svr.h3Server != nil)
+		}
+		if svr.httpServer != nil && svr.httpServer.TLSConfig == nil {
+			t.Errorf("%q: expected the TCP server to serve TLS", c.mode)
+		}
+	}
+
+	// the TLS mode is ignored without the certificate
+	svr := newTLSTestServer(t, "quic")
+	svr.CertFile, svr.KeyFile = "", ""
+	if err := svr.prepare(); err != nil || svr.h3Server != nil || svr.httpServer.TLSConfig != nil {
+		t.Errorf("expected a cleartext server, got %v", err)
+	}
+}
+
+// startTLSTestServer serves the server until the test ends
+func startTLSTestServer(t *testing.T, svr *Server) {
+	t.Helper()
+	if err := svr.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.listen(); err != nil {
+		t.Fatal(err)
+	}
+	go svr.serve()
+	t.Cleanup(func() { _ = svr.shutdown(context.Background()) })
+}
+
+func TestServerAltSvc(t *testing.T) {
+	tcpClient := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	for _, c := range []struct {
+		mode   string
+		altSvc bool
+	}{
+		{TLSModeBoth, true},
+		{TLSModeTCP, false},
+	} {
+		svr := newTLSTestServer(t, c.mode)
+		startTLSTestServer(t, svr)
+		resp, err := tcpClient.Get("https://localhost:" + strconv.Itoa(int(svr.Port)) + "/hello")
+		if err != nil {
+			t.Fatalf("%s: %v", c.mode, err)
+		}
+		resp.Body.Close()
+		altSvc := resp.Header.Get("Alt-Svc")
+		if c.altSvc != strings.Contains(altSvc, `h3=":`+strconv.Itoa(int(svr.Port))+`"`) {
+			t.Errorf("%s: expected HTTP/3 advertised %t, got Alt-Svc %q", c.mode, c.altSvc, altSvc)
+		}
+		if resp.ProtoMajor != 2 {
+			t.Errorf("%s: expected HTTP/2 over TLS, got %s", c.mode, resp.Proto)
+		}
+	}
+}
+
+func TestServerH3(t *testing.T) {
+	svr := newTLSTestServer(t, TLSModeH3)
+	startTLSTestServer(t, svr)
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	// the connection is closed before the server is shut down, which waits for it otherwise
+	t.Cleanup(func() { transport.Close() })
+	h3Client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+	resp, err := h3Client.Get("https://localhost:" + strconv.Itoa(int(svr.Port)) + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 3 || resp.Header.Get("Alt-Svc") != "" {
+		t.Errorf("expected HTTP/3 without Alt-Svc, got %s %q", resp.Proto, resp.Header.Get("Alt-Svc"))
+	}
+	if svr.listener != nil {
+		t.Error("expected no TCP listener")
+	}
+}
@@ -0,0 +1,255 @@
+package sprout
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/log"
+)
+
+const MimeEventStream = "text/event-stream"
+
+// SSEHandler pushes events to the client through the sink, the stream is closed once the handler returns
+type SSEHandler[I any, E any] func(ctx *Context, in I, sink *EventSink[E]) error
+
+// SSEEndpoint is an endpoint streaming Server-Sent Events of type E, it serves GET requests only.
+// The data of the events is serialized by the JSON serializer of the server, see Server.Serializers,
+// except for string events which are sent as they are.
+type SSEEndpoint[I any, E any] struct {
+	Name    string
+	Pattern string
+	Handler SSEHandler[I, E]
+	// interval of the heartbeat comments keeping the connection alive through proxies, no heartbeat is sent if zero.
+	// The heartbeats start once the stream has started, so that they do not commit the response of a handler
+	// failing before its first event.
+	Heartbeat time.Duration
+	// interceptors of this endpoint, see Endpoint.Interceptors
+	Interceptors []Interceptor
+	// whether to report all the invalid fields of the input, the mode of the server is used if not set
+	ValidationMode ValidationMode
+	// error handler for this endpoint, it only takes effect before the first event is sent,
+	// the errors after that are sent to the client as an "error" event
+	ErrorHandler
+}
+
+// Event is a Server-Sent Event, only Data is mandatory
+type Event[E any] struct {
+	Id   string
+	Name string
+	Data E
+	// reconnection time hint of the client
+	Retry time.Duration
+}
+
+// EventSink writes the events to the client, it is safe for concurrent use
+type EventSink[E any] struct {
+	ctx         *Context
+	flusher     http.Flusher
+	serializer  Serializer
+	lastEventId string
+
+	mu      sync.Mutex
+	started bool
+}
+
+// LastEventID returns the id of the last event received by the client before reconnecting,
+// the stream should be resumed from the event after it
+func (s *EventSink[E]) LastEventID() string {
+	return s.lastEventId
+}
+
+// Send sends an event with data only
+func (s *EventSink[E]) Send(data E) error {
+	return s.SendEvent(Event[E]{Data: data})
+}
+
+// SendEvent sends an event to the client and flushes it immediately
+func (s *EventSink[E]) SendEvent(event Event[E]) error {
+	var data []byte
+	if str, ok := any(event.Data).(string); ok {
+		data = []byte(str)
+	} else {
+		buf := &bufferWriter{}
+		err := s.serializer(event.Data, buf)
+		if err != nil {
+			return err
+		}
+		data = bytes.TrimRight(buf.Bytes(), "\n")
+	}
+
+	var b strings.Builder
+	if event.Id != "" {
+		b.WriteString("id: " + sanitizeEventField(event.Id) + "\n")
+	}
+	if event.Name != "" {
+		b.WriteString("event: " + sanitizeEventField(event.Name) + "\n")
+	}
+	if event.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		b.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Retry sends the reconnection time hint to the client
+func (s *EventSink[E]) Retry(d time.Duration) error {
+	return s.write("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n")
+}
+
+// heartbeat keeps the started stream alive, nothing is sent before the first event
+func (s *EventSink[E]) heartbeat() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		return nil
+	}
+	return s.writeLocked(": heartbeat\n\n")
+}
+
+func (s *EventSink[E]) write(frame string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeLocked(frame)
+}
+
+// writeLocked writes the frame, committing the response with the event stream headers before the first frame
+func (s *EventSink[E]) writeLocked(frame string) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if !s.started {
+		header := s.ctx.Writer.Header()
+		header.Set("Content-Type", MimeEventStream)
+		header.Set("Cache-Control", "no-cache")
+		// disable the response buffering of nginx
+		header.Set("X-Accel-Buffering", "no")
+		s.ctx.Writer.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+	_, err := s.ctx.Writer.Write([]byte(frame))
+	if err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *EventSink[E]) isStarted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+func (e *SSEEndpoint[I, E]) appendToServer(svr *Server, decrypters map[string]func(cipher []byte) ([]byte, error), g *Group) error {
+	inputType, err := inputStructType[I](e.Name)
+	if err != nil {
+		return err
+	}
+
+	r := &refinedEndpoint{
+		name:       e.Name,
+		pattern:    g.pattern(e.Pattern),
+		methods:    []string{http.MethodGet},
+		inputType:  inputType,
+		outputType: reflect.TypeOf((*E)(nil)).Elem(),
+		outputMime: MimeEventStream,
+	}
+
+	validateFunc, err := svr.buildValidateFuncs(e.Name, inputType, e.ValidationMode)
+	if err != nil {
+		return err
+	}
+
+	httpHandler := func(ctx *Context) error {
+		in, err := parseInput[I](ctx, svr, r.name, decrypters, validateFunc)
+		if err != nil {
+			return err
+		}
+		flusher, ok := ctx.Writer.(http.Flusher)
+		if !ok {
+			return errs.New("Streaming is not supported by the connection of endpoint [{0}]", r.name).WithStatus(http.StatusInternalServerError)
+		}
+		// the mux resolves the JSON serializer of the server for the event streams
+		serializer, _ := ctx.Value(ctxKeySerializer).(Serializer)
+		if serializer == nil {
+			serializer = SerializeJson
+		}
+		sink := &EventSink[E]{
+			ctx:         ctx,
+			flusher:     flusher,
+			serializer:  serializer,
+			lastEventId: ctx.Request.Header.Get("Last-Event-ID"),
+		}
+
+		stopHeartbeat := func() {}
+		if e.Heartbeat > 0 {
+			done := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ticker := time.NewTicker(e.Heartbeat)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-done:
+						return
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						if sink.heartbeat() != nil {
+							return
+						}
+					}
+				}
+			}()
+			// the heartbeat must not write to the response once the handler returns, even by panicking
+			stopHeartbeat = sync.OnceFunc(func() {
+				close(done)
+				wg.Wait()
+			})
+			defer stopHeartbeat()
+		}
+
+		err = e.Handler(ctx, in, sink)
+		stopHeartbeat()
+		if err != nil {
+			if svr.Debug {
+				log.ErrorErrF(`Endpoint [{0}] failed to process the request`, err, r.name)
+			}
+			markEndpointError(ctx, err)
+			if !sink.isStarted() {
+				return err
+			}
+			// the response has been committed, report the error in the stream
+			// the same details as the problem response, so that the server errors are not leaked
+			p := NewProblem(ctx.Request, err)
+			msg := p.Detail
+			if msg == "" {
+				msg = p.Title
+			}
+			if er := sink.write("event: error\ndata: " + strings.ReplaceAll(msg, "\n", " ") + "\n\n"); er != nil {
+				log.WarnErrF("Failed to send the error event of endpoint [{0}]", er, r.name)
+			}
+		}
+		return nil
+	}
+
+	r.httpHandler = svr.wrapHandler(r, g, e.Interceptors, e.ErrorHandler, httpHandler)
+	svr.endpoints = append(svr.endpoints, r)
+	return nil
+}
+
+// the id and event fields must not contain line breaks
+func sanitizeEventField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
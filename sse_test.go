@@ -0,0 +1,190 @@
+package sprout
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wxy365/basal/errs"
+)
+
+type sseTestInput struct {
+	Topic string `query:"topic"`
+}
+
+type sseTestEvent struct {
+	Seq int `json:"seq"`
+}
+
+func TestSSEAccept(t *testing.T) {
+	mx := newTestMux(t,
+		&SSEEndpoint[sseTestInput, sseTestEvent]{
+			Name:    "events",
+			Pattern: "/events",
+			Handler: func(ctx *Context, in sseTestInput, sink *EventSink[sseTestEvent]) error {
+				return sink.SendEvent(Event[sseTestEvent]{Id: "1", Data: sseTestEvent{Seq: 1}})
+			},
+		},
+		&Endpoint[sseTestInput, string]{
+			Name:    "hello",
+			Pattern: "/hello",
+			Methods: []string{http.MethodGet},
+			Handler: func(ctx *Context, in sseTestInput) (string, error) { return "hello", nil },
+		},
+	)
+	for _, c := range []struct {
+		path, accept string
+		status       int
+		contentType  string
+	}{
+		{"/events", MimeEventStream, http.StatusOK, MimeEventStream},
+		{"/events", "text/*;q=0.5, application/json", http.StatusOK, MimeEventStream},
+		{"/events", "", http.StatusOK, MimeEventStream},
+		{"/events", "application/xml", http.StatusNotAcceptable, "application/problem+json"},
+		{"/hello", MimeEventStream, http.StatusNotAcceptable, "application/problem+json"},
+		{"/nope", MimeEventStream, http.StatusNotFound, "application/problem+json"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, c.path, nil)
+		r.Header.Set("Accept", c.accept)
+		w := serve(mx, r)
+		if w.Code != c.status || w.Header().Get("Content-Type") != c.contentType {
+			t.Errorf("%s with %q: expected %d %s, got %d %s", c.path, c.accept, c.status, c.contentType, w.Code, w.Header().Get("Content-Type"))
+		}
+		if c.status == http.StatusOK && w.Body.String() != "id: 1\ndata: {\"seq\":1}\n\n" {
+			t.Errorf("%s with %q: unexpected stream %q", c.path, c.accept, w.Body.String())
+		}
+	}
+}
+
+// lateWriteRecorder counts the writes after the request has been served
+type lateWriteRecorder struct {
+	*httptest.ResponseRecorder
+	mu     sync.Mutex
+	served bool
+	late   int
+}
+
+func (w *lateWriteRecorder) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.served {
+		w.late++
+	}
+	return w.ResponseRecorder.Write(b)
+}
+
+func (w *lateWriteRecorder) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ResponseRecorder.Flush()
+}
+
+func TestSSEHeartbeatStopped(t *testing.T) {
+	mx := newTestMux(t, &SSEEndpoint[sseTestInput, string]{
+		Name:      "ticks",
+		Pattern:   "/ticks",
+		Heartbeat: time.Millisecond,
+		Handler: func(ctx *Context, in sseTestInput, sink *EventSink[string]) error {
+			if err := sink.Send("hi"); err != nil {
+				return err
+			}
+			time.Sleep(20 * time.Millisecond)
+			return sink.Send("bye")
+		},
+	})
+	for i := 0; i < 5; i++ {
+		w := &lateWriteRecorder{ResponseRecorder: httptest.NewRecorder()}
+		mx.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ticks", nil))
+		w.mu.Lock()
+		w.served = true
+		w.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		w.mu.Lock()
+		if w.late > 0 {
+			t.Errorf("expected no write after the request is served, got %d", w.late)
+		}
+		// the heartbeats start after the first event
+		body := w.Body.String()
+		if !strings.HasPrefix(body, "data: hi\n\n") || !strings.Contains(body, ": heartbeat\n\n") || !strings.Contains(body, "data: bye\n\n") {
+			t.Errorf("unexpected stream %q", body)
+		}
+		w.mu.Unlock()
+	}
+}
+
+func TestSSEServerSerializer(t *testing.T) {
+	svr := newDefaultServer("test")
+	svr.Serializers = map[string]Serializer{
+		MimeJson: func(model any, w http.ResponseWriter) error {
+			_, err := w.Write([]byte(`{"custom":true}`))
+			return err
+		},
+	}
+	mx := newServerTestMux(t, svr, &SSEEndpoint[sseTestInput, sseTestEvent]{
+		Name:    "events",
+		Pattern: "/events",
+		Handler: func(ctx *Context, in sseTestInput, sink *EventSink[sseTestEvent]) error {
+			return sink.Send(sseTestEvent{Seq: 1})
+		},
+	})
+	r := httptest.NewRequest(http.MethodGet, "/events", nil)
+	r.Header.Set("Accept", MimeEventStream)
+	if w := serve(mx, r); w.Body.String() != "data: {\"custom\":true}\n\n" {
+		t.Errorf("expected the event serialized by the server serializer, got %q", w.Body.String())
+	}
+}
+
+func TestSSEErrorEvent(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		data string
+	}{
+		// the details of the server errors are hidden
+		{errors.New("dial tcp 10.0.0.1:5432: connection refused"), "Internal Server Error"},
+		{errs.Wrap(errors.New("connection refused"), "Failed to query\nthe events"), "Failed to query the events"},
+		{errs.New("Topic [{0}] not found", "news").WithStatus(http.StatusNotFound), "Topic [news] not found"},
+	} {
+		mx := newTestMux(t, &SSEEndpoint[sseTestInput, sseTestEvent]{
+			Name:    "events",
+			Pattern: "/events",
+			Handler: func(ctx *Context, in sseTestInput, sink *EventSink[sseTestEvent]) error {
+				if err := sink.Send(sseTestEvent{Seq: 1}); err != nil {
+					return err
+				}
+				return c.err
+			},
+		})
+		r := httptest.NewRequest(http.MethodGet, "/events", nil)
+		r.Header.Set("Accept", MimeEventStream)
+		expected := "data: {\"seq\":1}\n\nevent: error\ndata: " + c.data + "\n\n"
+		if w := serve(mx, r); w.Body.String() != expected {
+			t.Errorf("expected %q, got %q", expected, w.Body.String())
+		}
+	}
+}
+
+func TestSSEFailedBeforeFirstEvent(t *testing.T) {
+	mx := newTestMux(t, &SSEEndpoint[sseTestInput, sseTestEvent]{
+		Name:      "events",
+		Pattern:   "/events",
+		Heartbeat: time.Millisecond,
+		Handler: func(ctx *Context, in sseTestInput, sink *EventSink[sseTestEvent]) error {
+			// the heartbeats are due, but the stream has not started
+			time.Sleep(10 * time.Millisecond)
+			return errs.New("Topic [{0}] not found", in.Topic).WithStatus(http.StatusNotFound)
+		},
+	})
+	r := httptest.NewRequest(http.MethodGet, "/events?topic=news", nil)
+	r.Header.Set("Accept", MimeEventStream)
+	w := serve(mx, r)
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != MimeProblemJson {
+		t.Errorf("expected the problem response, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if body := w.Body.String(); strings.Contains(body, "heartbeat") || !strings.Contains(body, "Topic [news] not found") {
+		t.Errorf("unexpected problem %q", body)
+	}
+}
@@ -0,0 +1,168 @@
+package sprout
+
+import (
+	urlpkg "net/url"
+	"reflect"
+	"strings"
+
+	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/rflt"
+)
+
+// ExpandPattern fills the named sections of the uri pattern, eg. {id}, {id:~\d+}, v{version}, {name}.{ext} and
+// {path...}, with the path parameters, which are escaped and checked against the regular expressions of the
+// sections. The other text is kept as is, so that it also works with the urls of the clients.
+func ExpandPattern(pattern string, params map[string]string) (string, error) {
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		raw := strings.TrimSpace(part)
+		if raw != "**" && !strings.Contains(raw, "{") {
+			continue
+		}
+		seg, err := parseSegment(raw)
+		if err != nil {
+			return "", errs.Wrap(err, "Invalid uri pattern [{0}]", pattern)
+		}
+		switch seg.kind {
+		case segmentCatchAll:
+			if i < len(parts)-1 {
+				return "", errs.New("The catch-all section [{0}] should be the last one of uri pattern [{1}]", raw, pattern)
+			}
+			value, err := patternParam(pattern, params, seg.name)
+			if err != nil {
+				return "", err
+			}
+			pieces := strings.Split(value, "/")
+			for j, piece := range pieces {
+				pieces[j] = urlpkg.PathEscape(piece)
+			}
+			parts[i] = strings.Join(pieces, "/")
+		case segmentNamed, segmentNamedRegexp:
+			value, err := patternParam(pattern, params, seg.name)
+			if err != nil {
+				return "", err
+			}
+			if !seg.match(value) {
+				return "", errs.New("The path parameter [{0}] of uri pattern [{1}] does not match [{2}]", seg.name, pattern, raw)
+			}
+			parts[i] = urlpkg.PathEscape(value)
+		case segmentMixed:
+			tokens, _ := splitSegment(raw)
+			var text, escaped strings.Builder
+			for _, t := range tokens {
+				if t.param == nil {
+					text.WriteString(t.text)
+					escaped.WriteString(t.text)
+					continue
+				}
+				value, err := patternParam(pattern, params, t.param.name)
+				if err != nil {
+					return "", err
+				}
+				text.WriteString(value)
+				escaped.WriteString(urlpkg.PathEscape(value))
+			}
+			if !seg.match(text.String()) {
+				return "", errs.New("The path section [{0}] of uri pattern [{1}] does not match [{2}]", text.String(), pattern, raw)
+			}
+			parts[i] = escaped.String()
+		}
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+func patternParam(pattern string, params map[string]string, name string) (string, error) {
+	value, exists := params[name]
+	if !exists {
+		return "", errs.New("The path parameter [{0}] of uri pattern [{1}] is absent", name, pattern)
+	}
+	return value, nil
+}
+
+// URLFor builds the URL path of the named endpoint from the path parameters, eg. for the Location header,
+// links and redirects
+func (s *Server) URLFor(name string, params map[string]string) (string, error) {
+	pattern, err := s.urlPattern(name)
+	if err != nil {
+		return "", err
+	}
+	return ExpandPattern(pattern, params)
+}
+
+// URLForInput builds the URL of the named endpoint from its input, the fields with the path tag fill the path
+// parameters, and the non-zero ones with the query tag make up the query string
+func URLForInput[I any](s *Server, name string, in I) (string, error) {
+	pattern, err := s.urlPattern(name)
+	if err != nil {
+		return "", err
+	}
+	ep := s.endpoint(name)
+	v := reflect.ValueOf(in)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() == reflect.Pointer {
+		return "", errs.New("The input of endpoint [{0}] is nil", name)
+	}
+	if v.Type() != ep.inputType {
+		return "", errs.New("The input of endpoint [{0}] is of type [{1}], but got [{2}]", name, ep.inputType, v.Type())
+	}
+	params := make(map[string]string)
+	query := make(urlpkg.Values)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		fv := v.Field(i)
+		pname, isPath := f.Tag.Lookup("path")
+		if !isPath {
+			var isQuery bool
+			if pname, isQuery = f.Tag.Lookup("query"); !isQuery || fv.IsZero() {
+				continue
+			}
+		} else if fv.Kind() == reflect.Pointer && fv.IsNil() {
+			continue
+		}
+		valStr, err := rflt.ValueToString(fv)
+		if err != nil {
+			return "", errs.Wrap(err, "Failed to convert field [{0}] of endpoint [{1}] to string", f.Name, name)
+		}
+		if isPath {
+			params[pname] = valStr
+		} else {
+			query.Set(pname, valStr)
+		}
+	}
+	path, err := ExpandPattern(pattern, params)
+	if err != nil {
+		return "", err
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path, nil
+}
+
+// urlPattern returns the pattern of the named endpoint, whose sections should all be static or named
+func (s *Server) urlPattern(name string) (string, error) {
+	ep := s.endpoint(name)
+	if ep == nil {
+		return "", errs.New("Endpoint [{0}] not found in server [{1}]", name, s.Name)
+	}
+	pattern := "/" + normalizePath(ep.pattern)
+	for _, part := range strings.Split(pattern, "/") {
+		switch part = strings.TrimSpace(part); {
+		case part == "*", part == "%d", part == "%s", strings.HasPrefix(part, "~"):
+			return "", errs.New("The section [{0}] of endpoint [{1}] has no name to be filled", part, name)
+		}
+	}
+	return pattern, nil
+}
+
+// endpoint returns the first endpoint of the name
+func (s *Server) endpoint(name string) *refinedEndpoint {
+	for _, ep := range s.endpoints {
+		if ep.name == name {
+			return ep
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package sprout
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type urlTestInput struct {
+	Id     int    `path:"id"`
+	Tab    string `query:"tab"`
+	Page   int    `query:"page"`
+	Filter string `json:"filter"`
+}
+
+func TestURLForInput(t *testing.T) {
+	svr := newDefaultServer("test")
+	mountTestEndpoints(t, svr, &Endpoint[urlTestInput, string]{
+		Name:    "user",
+		Pattern: "/users/{id:~\\d+}",
+		Methods: []string{http.MethodGet},
+		Handler: func(ctx *Context, in urlTestInput) (string, error) { return "", nil },
+	})
+
+	in := urlTestInput{Id: 12, Tab: "a b", Filter: "ignored"}
+	for _, c := range []struct {
+		name     string
+		url      func() (string, error)
+		expected string
+		err      string
+	}{
+		{"value", func() (string, error) { return URLForInput(svr, "user", in) }, "/users/12?tab=a+b", ""},
+		{"pointer", func() (string, error) { return URLForInput(svr, "user", &in) }, "/users/12?tab=a+b", ""},
+		{"params", func() (string, error) { return svr.URLFor("user", map[string]string{"id": "3"}) }, "/users/3", ""},
+		{"unknown endpoint", func() (string, error) { return URLForInput(svr, "users", in) }, "", "not found"},
+		{"other type", func() (string, error) { return URLForInput(svr, "user", responseTestInput{}) }, "", "is of type"},
+		{"nil interface", func() (string, error) { return URLForInput[any](svr, "user", nil) }, "", "is nil"},
+		{"nil pointer", func() (string, error) { return URLForInput[*urlTestInput](svr, "user", nil) }, "", "is nil"},
+	} {
+		url, err := c.url()
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected the error %q, got %s %v", c.name, c.err, url, err)
+			}
+		} else if err != nil || url != c.expected {
+			t.Errorf("%s: expected %s, got %s %v", c.name, c.expected, url, err)
+		}
+	}
+}
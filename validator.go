@@ -1,19 +1,25 @@
 package sprout
 
 import (
+	"cmp"
 	"context"
-	"math"
+	"errors"
+	"fmt"
 	"net/http"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-	"unicode/utf8"
+	"time"
 
 	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/i18n"
+	"github.com/wxy365/basal/log"
 )
 
-var emailRegex = regexp.MustCompile(`^[\w-]+(\.[\w-]+)*@[\w-]+(\.[\w-]+)+$`)
+// the local part allows the atext characters of RFC 5322, eg. a+tag@example.com
+var emailRegex = regexp.MustCompile(`^[\w!#$%&'*+/=?^{|}~-]+(\.[\w!#$%&'*+/=?^{|}~-]+)*@[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)+$`)
 
 func defaultValidators() []Validator {
 	return []Validator{
@@ -22,10 +28,29 @@ func defaultValidators() []Validator {
 		&EitherValidator{},
 		&NumberRangeValidator{},
 		&StringLengthValidator{},
+		&RangeValidator{},
+		&LengthValidator{},
 		&EmailValidator{},
+		&FormatValidator{},
+		&CollectionValidator{},
+		&CrossFieldValidator{},
 	}
 }
 
+// ValidationMode decides whether the validation stops at the first invalid field
+type ValidationMode int
+
+const (
+	// ValidationDefault takes the mode of the server for the endpoints, and ValidationFailFast for the servers
+	ValidationDefault ValidationMode = iota
+	// ValidationFailFast reports the first invalid field only
+	ValidationFailFast
+	// ValidationAggregate reports all the invalid fields
+	ValidationAggregate
+)
+
+// Validator builds the validate function of a field from its validate tag, nil is returned if the tag has no rule
+// of the validator. The validate function should report the failed rule as the code of the error, see ruleError.
 type Validator interface {
 	ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc
 }
@@ -34,6 +59,266 @@ type ValidateFunc func(ctx context.Context, fieldIdx int, struValue reflect.Valu
 
 type ObjectValidateFunc func(ctx context.Context, obj reflect.Value) error
 
+// Validatable is implemented by the inputs, or the structs nested in the inputs, that validate themselves as a whole.
+// Validate is called after the rules of the fields, the ValidationErrors returned are reported with the field paths
+// relative to the struct, and the other errors are reported on the struct.
+type Validatable interface {
+	Validate(ctx context.Context) error
+}
+
+var typeValidatable = reflect.TypeOf((*Validatable)(nil)).Elem()
+
+// chainValidateFuncs chains the validate functions of the rules of a field, the first error is returned
+func chainValidateFuncs(funcs []ValidateFunc) ValidateFunc {
+	switch len(funcs) {
+	case 0:
+		return nil
+	case 1:
+		return funcs[0]
+	}
+	return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
+		for _, vdFunc := range funcs {
+			if err := vdFunc(ctx, fieldIdx, struValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// ruleError creates the error of a failed validate rule with the localized message
+func ruleError(ctx context.Context, rule, key string, args ...any) *errs.Err {
+	return errs.I18nNew(ctx, key, args...).WithCode(rule).WithStatus(http.StatusBadRequest)
+}
+
+// structValidator validates the fields of a struct
+type structValidator struct {
+	fields []fieldValidator
+	// whether the struct implements Validatable
+	self bool
+}
+
+type fieldValidator struct {
+	idx int
+	// name of the field in the field path
+	name   string
+	funcs  []ValidateFunc
+	nested *structValidator
+	elem   *elemValidator
+}
+
+func (sv *structValidator) empty() bool {
+	return len(sv.fields) == 0 && !sv.self
+}
+
+func (fv *fieldValidator) empty() bool {
+	return len(fv.funcs) == 0 && fv.nested == nil && fv.elem == nil
+}
+
+// validate validates the struct value and collects the field errors, it returns false once an error is found
+// if not aggregating. Every field reports its first failed rule only, the nested structs and the elements are
+// validated even if the rules of the field failed when aggregating.
+func (sv *structValidator) validate(ctx context.Context, v reflect.Value, path string, aggregate bool, fieldErrs *ValidationErrors) bool {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	for i := range sv.fields {
+		if !sv.fields[i].validate(ctx, v, joinFieldPath(path, sv.fields[i].name), aggregate, fieldErrs) {
+			return false
+		}
+	}
+	if !sv.self {
+		return true
+	}
+	if !v.CanAddr() {
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		v = cp
+	}
+	err := v.Addr().Interface().(Validatable).Validate(ctx)
+	if err == nil {
+		return true
+	}
+	var selfErrs ValidationErrors
+	if errors.As(err, &selfErrs) {
+		for _, fe := range selfErrs {
+			fe.Field = joinFieldPath(path, fe.Field)
+			*fieldErrs = append(*fieldErrs, fe)
+		}
+	} else {
+		fieldErrs.add(path, err)
+	}
+	return aggregate
+}
+
+func (fv *fieldValidator) validate(ctx context.Context, struValue reflect.Value, path string, aggregate bool, fieldErrs *ValidationErrors) bool {
+	for _, vdFunc := range fv.funcs {
+		if err := vdFunc(ctx, fv.idx, struValue); err != nil {
+			fieldErrs.add(path, err)
+			if !aggregate {
+				return false
+			}
+			break
+		}
+	}
+	if fv.nested != nil && !fv.nested.validate(ctx, struValue.Field(fv.idx), path, aggregate, fieldErrs) {
+		return false
+	}
+	if fv.elem != nil && !fv.elem.validate(ctx, struValue.Field(fv.idx), path, aggregate, fieldErrs) {
+		return false
+	}
+	return true
+}
+
+// elemValidator validates the elements of a slice, array or map. The rules of the elements are run against
+// a holder struct whose only field is the element, so that all the validators apply to the elements as well.
+type elemValidator struct {
+	holder reflect.Type
+	field  fieldValidator
+	// validator of the map keys
+	key *elemValidator
+}
+
+func (ev *elemValidator) validate(ctx context.Context, v reflect.Value, path string, aggregate bool, fieldErrs *ValidationErrors) bool {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !ev.validateElem(ctx, v.Index(i), path+"["+strconv.Itoa(i)+"]", aggregate, fieldErrs) {
+				return false
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = fmt.Sprint(k.Interface())
+		}
+		sort.Sort(mapKeys{keys, names})
+		for i, k := range keys {
+			elemPath := path + "[" + names[i] + "]"
+			if ev.key != nil && !ev.key.validateElem(ctx, k, elemPath, aggregate, fieldErrs) {
+				return false
+			}
+			if !ev.validateElem(ctx, v.MapIndex(k), elemPath, aggregate, fieldErrs) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (ev *elemValidator) validateElem(ctx context.Context, elem reflect.Value, path string, aggregate bool, fieldErrs *ValidationErrors) bool {
+	if ev.field.empty() {
+		return true
+	}
+	holder := reflect.New(ev.holder).Elem()
+	holder.Field(0).Set(elem)
+	return ev.field.validate(ctx, holder, path, aggregate, fieldErrs)
+}
+
+// mapKeys sorts the map keys by their names, so that the errors are reported in a stable order
+type mapKeys struct {
+	keys  []reflect.Value
+	names []string
+}
+
+func (m mapKeys) Len() int {
+	return len(m.keys)
+}
+
+func (m mapKeys) Less(i, j int) bool {
+	return m.names[i] < m.names[j]
+}
+
+func (m mapKeys) Swap(i, j int) {
+	m.keys[i], m.keys[j] = m.keys[j], m.keys[i]
+	m.names[i], m.names[j] = m.names[j], m.names[i]
+}
+
+// splitDiveTag splits the validate tag at the dive rule, the rules before it apply to the field
+// and the ones after it apply to the elements, eg. max_items=10;dive;required;[1,32]
+func splitDiveTag(validateTag string) (fieldTag, elemTag string, dive bool) {
+	frags := strings.Split(validateTag, ";")
+	for i, frag := range frags {
+		if strings.TrimSpace(frag) == "dive" {
+			return strings.Join(frags[:i], ";"), strings.Join(frags[i+1:], ";"), true
+		}
+	}
+	return validateTag, "", false
+}
+
+// splitKeysTag splits the rules of the map keys enclosed by keys and endkeys from the element rules,
+// eg. keys;[1,16];endkeys;required
+func splitKeysTag(elemTag string) (keyTag, valueTag string, err error) {
+	frags := strings.Split(elemTag, ";")
+	if strings.TrimSpace(frags[0]) != "keys" {
+		return "", elemTag, nil
+	}
+	for i, frag := range frags {
+		if strings.TrimSpace(frag) == "endkeys" {
+			return strings.Join(frags[1:i], ";"), strings.Join(frags[i+1:], ";"), nil
+		}
+	}
+	return "", "", errs.New("The keys rule of [{0}] is not closed by endkeys", elemTag)
+}
+
+func (v *ValidationErrors) add(field string, err error) {
+	fe := FieldError{Field: field, Message: err.Error()}
+	var leiErr *errs.Err
+	if errors.As(err, &leiErr) {
+		fe.Rule, fe.Message = leiErr.Code, leiErr.Message
+	}
+	*v = append(*v, fe)
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" || name == "" {
+		return path + name
+	}
+	return path + "." + name
+}
+
+// fieldLabel returns the name of the field in the messages, which is the label tag translated as a message key,
+// eg. label:"user.email" or label:"Email address", or the field name if the tag is absent
+func fieldLabel(ctx context.Context, f reflect.StructField) string {
+	label := f.Tag.Get("label")
+	if label == "" {
+		return f.Name
+	}
+	return i18n.Message(ctx, label)
+}
+
+func fieldLabels(ctx context.Context, fields []reflect.StructField) string {
+	labels := make([]string, len(fields))
+	for i, f := range fields {
+		labels[i] = fieldLabel(ctx, f)
+	}
+	return strings.Join(labels, ",")
+}
+
+// validationFieldName returns the name of the field in the field path: the name of the path, query,
+// header or cookie parameter, or the JSON name of the body field
+func validationFieldName(f reflect.StructField) string {
+	for _, tag := range []string{"path", "query", "header", "cookie"} {
+		if name, ok := f.Tag.Lookup(tag); ok && name != "" {
+			return name
+		}
+	}
+	if name, _ := jsonFieldName(f); name != "" {
+		return name
+	}
+	return f.Name
+}
+
 type RequiredValidator struct{}
 
 func (r *RequiredValidator) ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc {
@@ -43,7 +328,7 @@ func (r *RequiredValidator) ValidateFunc(validateTag string, fieldIdx int, struT
 			return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
 				fieldValue := struValue.Field(fieldIdx)
 				if fieldValue.IsZero() {
-					return errs.I18nNew(ctx, "sprout.params.required", struType.Field(fieldIdx).Name, http.StatusBadRequest)
+					return ruleError(ctx, "required", "sprout.params.required", fieldLabel(ctx, struType.Field(fieldIdx)))
 				}
 				return nil
 			}
@@ -64,13 +349,8 @@ func (r *RequiredByValidator) ValidateFunc(validateTag string, fieldIdx int, str
 			}
 			var validFieldNames []string
 			for _, fieldName := range strings.Split(fieldNames, ",") {
-				_, ok := struType.FieldByName(fieldName)
-				if ok {
-					validFieldNames = append(validFieldNames, fieldName)
-				}
-			}
-			if len(validFieldNames) == 0 {
-				return nil
+				lookupReferredField(struType, fieldIdx, strings.TrimSpace(fieldName))
+				validFieldNames = append(validFieldNames, strings.TrimSpace(fieldName))
 			}
 			return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
 				fieldValue := struValue.Field(fieldIdx)
@@ -80,7 +360,7 @@ func (r *RequiredByValidator) ValidateFunc(validateTag string, fieldIdx int, str
 				for _, fieldName := range validFieldNames {
 					fv := struValue.FieldByName(fieldName)
 					if !fv.IsZero() {
-						return errs.I18nNew(ctx, "sprout.params.required", struType.Field(fieldIdx).Name).WithStatus(http.StatusBadRequest)
+						return ruleError(ctx, "required_by", "sprout.params.required", fieldLabel(ctx, struType.Field(fieldIdx)))
 					}
 				}
 				return nil
@@ -102,13 +382,8 @@ func (e *EitherValidator) ValidateFunc(validateTag string, fieldIdx int, struTyp
 			}
 			var validFieldNames []string
 			for _, fieldName := range strings.Split(fieldNames, ",") {
-				_, ok := struType.FieldByName(fieldName)
-				if ok {
-					validFieldNames = append(validFieldNames, fieldName)
-				}
-			}
-			if len(validFieldNames) == 0 {
-				return nil
+				lookupReferredField(struType, fieldIdx, strings.TrimSpace(fieldName))
+				validFieldNames = append(validFieldNames, strings.TrimSpace(fieldName))
 			}
 			return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
 				fieldValue := struValue.Field(fieldIdx)
@@ -121,220 +396,376 @@ func (e *EitherValidator) ValidateFunc(validateTag string, fieldIdx int, struTyp
 						return nil
 					}
 				}
-				return errs.I18nNew(ctx, "sprout.params.require-one", struType.Field(fieldIdx).Name).WithStatus(http.StatusBadRequest)
+				return ruleError(ctx, "either", "sprout.params.require-one", fieldLabel(ctx, struType.Field(fieldIdx)))
 			}
 		}
 	}
 	return nil
 }
 
+// NumberRangeValidator validates the number fields with the legacy tags like [1,10] or (0,1).
+//
+// Deprecated: use the range rule of RangeValidator, eg. range=[1,10].
 type NumberRangeValidator struct{}
 
 func (n *NumberRangeValidator) ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc {
-	var bottom, upper string
-	var ge, le bool
+	iv, frag, ok := legacyInterval(validateTag)
+	field := struType.Field(fieldIdx)
+	if !ok {
+		return nil
+	}
+	switch derefType(field.Type).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		log.Warn("The validate tag [{0}] of {1}.{2} is deprecated, use range={0} instead", frag, struType.Name(), field.Name)
+		return rangeValidateFunc("range", iv, fieldIdx, struType)
+	}
+	return nil
+}
+
+// StringLengthValidator validates the string fields with the legacy tags like [1,10] or (0,10).
+//
+// Deprecated: use the len rule of LengthValidator, eg. len=[1,10].
+type StringLengthValidator struct{}
+
+func (s *StringLengthValidator) ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc {
+	iv, frag, ok := legacyInterval(validateTag)
+	field := struType.Field(fieldIdx)
+	if !ok || derefType(field.Type).Kind() != reflect.String {
+		return nil
+	}
+	log.Warn("The validate tag [{0}] of {1}.{2} is deprecated, use len={0} instead", frag, struType.Name(), field.Name)
+	return lengthValidateFunc("len", iv, fieldIdx, struType)
+}
+
+// legacyInterval looks up the legacy range tag like [1,10]
+func legacyInterval(validateTag string) (interval, string, bool) {
 	for _, frag := range strings.Split(validateTag, ";") {
 		frag = strings.TrimSpace(frag)
-		if (strings.HasPrefix(frag, "[") || strings.HasPrefix(frag, "(")) && (strings.HasSuffix(frag, "]") || strings.HasSuffix(frag, ")")) {
-			ranges := strings.Split(frag[1:len(frag)-1], ",")
-			if len(ranges) != 2 {
+		if iv, ok := parseInterval(frag); ok {
+			return iv, frag, true
+		}
+	}
+	return interval{}, "", false
+}
+
+type EmailValidator struct{}
+
+func (e *EmailValidator) ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc {
+	for _, frag := range strings.Split(validateTag, ";") {
+		frag = strings.TrimSpace(frag)
+		if frag == "email" {
+			return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
+				fieldValue, ok := formatString(struValue.Field(fieldIdx))
+				if ok && !emailRegex.MatchString(fieldValue) {
+					return ruleError(ctx, "email", "sprout.params.invalid-email", fieldValue)
+				}
 				return nil
 			}
-			bottom = strings.TrimSpace(ranges[0])
-			upper = strings.TrimSpace(ranges[1])
-			if strings.HasPrefix(frag, "[") {
-				ge = true
-			}
-			if strings.HasSuffix(frag, "]") {
-				le = true
-			}
-			break
 		}
 	}
-	if bottom == "" && upper == "" {
+	return nil
+}
+
+// CollectionValidator validates the items of slices, arrays and maps with the rules min_items=n, max_items=n,
+// unique, and unique=Field for the items of struct type. Nil collections are regarded as absent and left to the
+// required rule.
+type CollectionValidator struct{}
+
+func (c *CollectionValidator) ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc {
+	minItems, maxItems := -1, -1
+	var unique bool
+	var uniqueField string
+	field := struType.Field(fieldIdx)
+	for _, frag := range strings.Split(validateTag, ";") {
+		frag = strings.TrimSpace(frag)
+		var err error
+		switch {
+		case strings.HasPrefix(frag, "min_items="):
+			minItems, err = strconv.Atoi(strings.TrimPrefix(frag, "min_items="))
+		case strings.HasPrefix(frag, "max_items="):
+			maxItems, err = strconv.Atoi(strings.TrimPrefix(frag, "max_items="))
+		case frag == "unique":
+			unique = true
+		case strings.HasPrefix(frag, "unique="):
+			unique, uniqueField = true, strings.TrimPrefix(frag, "unique=")
+		}
+		if err != nil || (minItems < -1 || maxItems < -1) {
+			panic(errs.New("The rule [{0}] of {1}.{2} is invalid", frag, struType.Name(), field.Name))
+		}
+	}
+	if minItems < 0 && maxItems < 0 && !unique {
 		return nil
 	}
-	field := struType.Field(fieldIdx)
-	switch field.Type.Kind() {
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		var minVal, maxVal int
-		if bottom == "" {
-			minVal = math.MinInt
-		} else {
-			minI64, err := strconv.ParseInt(bottom, 10, 64)
-			if err != nil {
-				panic(errs.New("The min value [{0}] of {1}.{2} is invalid", bottom, struType.Name(), field.Name))
-			}
-			minVal = int(minI64)
-		}
-		if upper == "" {
-			maxVal = math.MaxInt
-		} else {
-			maxI64, err := strconv.ParseInt(upper, 10, 64)
-			if err != nil {
-				panic(errs.New("The max value [{0}] of {1}.{2} is invalid", upper, struType.Name(), field.Name))
+	collType := derefType(field.Type)
+	if collType.Kind() != reflect.Slice && collType.Kind() != reflect.Array && collType.Kind() != reflect.Map {
+		panic(errs.New("The item rules of {0}.{1} only apply to slices, arrays and maps", struType.Name(), field.Name))
+	}
+	if minItems >= 0 && maxItems >= 0 && minItems > maxItems {
+		panic(errs.New("The min items [{0}] of {1}.{2} is greater than the max items [{3}]", minItems, struType.Name(), field.Name, maxItems))
+	}
+
+	var uniqueIdx []int
+	if unique {
+		itemType := derefType(collType.Elem())
+		if uniqueField != "" {
+			f, ok := itemType.FieldByName(uniqueField)
+			if itemType.Kind() != reflect.Struct || !ok || !f.IsExported() {
+				panic(errs.New("The items of {0}.{1} have no field [{2}] to be unique", struType.Name(), field.Name, uniqueField))
 			}
-			maxVal = int(maxI64)
+			itemType, uniqueIdx = f.Type, f.Index
 		}
-		if minVal > maxVal {
-			panic(errs.New("The min value [{0}] of {1}.{2} is greater than the max value [{3}]", bottom, struType.Name(), field.Name, upper))
+		if !itemType.Comparable() {
+			panic(errs.New("The items of {0}.{1} are not comparable to be unique", struType.Name(), field.Name))
 		}
-		return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
-			fieldValue := struValue.Field(fieldIdx).Int()
-			if fieldValue == 0 {
+	}
+
+	return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
+		fieldValue := struValue.Field(fieldIdx)
+		for fieldValue.Kind() == reflect.Pointer {
+			if fieldValue.IsNil() {
 				return nil
 			}
-			if (ge && fieldValue < int64(minVal)) || (!ge && fieldValue <= int64(minVal)) || (le && fieldValue > int64(maxVal)) || (!le && fieldValue >= int64(maxVal)) {
-				return errs.I18nNew(ctx, "sprout.params.out-of-range", struValue.Type().Field(fieldIdx).Name, minVal, maxVal).WithStatus(http.StatusBadRequest)
-			}
+			fieldValue = fieldValue.Elem()
+		}
+		if fieldValue.Kind() != reflect.Array && fieldValue.IsNil() {
 			return nil
 		}
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		var minVal, maxVal uint
-		if bottom == "" {
-			minVal = 0
-		} else {
-			minU64, err := strconv.ParseUint(bottom, 10, 64)
-			if err != nil {
-				panic(errs.New("The min value [{0}] of {1}.{2} is invalid", bottom, struType.Name(), field.Name))
-			}
-			minVal = uint(minU64)
-		}
-		if upper == "" {
-			maxVal = math.MaxUint
-		} else {
-			maxU64, err := strconv.ParseUint(upper, 10, 64)
-			if err != nil {
-				panic(errs.New("The max value [{0}] of {1}.{2} is invalid", upper, struType.Name(), field.Name))
-			}
-			maxVal = uint(maxU64)
+		n := fieldValue.Len()
+		if minItems >= 0 && n < minItems {
+			return ruleError(ctx, "min_items", "sprout.params.too-few-items", fieldLabel(ctx, field), minItems)
 		}
-		if minVal > maxVal {
-			panic(errs.New("The min value [{0}] of {1}.{2} is greater than the max value [{3}]", bottom, struType.Name(), field.Name, upper))
+		if maxItems >= 0 && n > maxItems {
+			return ruleError(ctx, "max_items", "sprout.params.too-many-items", fieldLabel(ctx, field), maxItems)
 		}
-		return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
-			fieldValue := struValue.Field(fieldIdx).Uint()
-			if fieldValue == 0 {
-				return nil
-			}
-			if (ge && fieldValue < uint64(minVal)) || (!ge && fieldValue <= uint64(minVal)) || (le && fieldValue > uint64(maxVal)) || (!le && fieldValue >= uint64(maxVal)) {
-				return errs.I18nNew(ctx, "sprout.params.out-of-range", struValue.Type().Field(fieldIdx).Name, minVal, maxVal).WithStatus(http.StatusBadRequest)
-			}
+		if !unique {
 			return nil
 		}
-	case reflect.Float32, reflect.Float64:
-		var minVal, maxVal float64
-		if bottom == "" {
-			minVal = math.MinInt64
-		} else {
-			minF64, err := strconv.ParseFloat(bottom, 64)
-			if err != nil {
-				panic(errs.New("The min value [{0}] of {1}.{2} is invalid", bottom, struType.Name(), field.Name))
+		seen := make(map[any]struct{}, n)
+		checkItem := func(item reflect.Value) error {
+			for item.Kind() == reflect.Pointer {
+				if item.IsNil() {
+					return nil
+				}
+				item = item.Elem()
 			}
-			minVal = minF64
-		}
-		if upper == "" {
-			maxVal = math.MaxFloat64
-		} else {
-			maxF64, err := strconv.ParseFloat(upper, 64)
-			if err != nil {
-				panic(errs.New("The max value [{0}] of {1}.{2} is invalid", upper, struType.Name(), field.Name))
+			if uniqueIdx != nil {
+				item = item.FieldByIndex(uniqueIdx)
 			}
-			maxVal = maxF64
-		}
-		if minVal > maxVal {
-			panic(errs.New("The min value [{0}] of {1}.{2} is greater than the max value [{3}]", bottom, struType.Name(), field.Name, upper))
-		}
-		return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
-			fieldValue := struValue.Field(fieldIdx).Float()
-			if fieldValue == 0 {
-				return nil
+			key := item.Interface()
+			if _, exists := seen[key]; exists {
+				return ruleError(ctx, "unique", "sprout.params.duplicate-items", fieldLabel(ctx, field), key)
 			}
-			if (fieldValue < minVal) || (!ge && fieldValue == minVal) || (fieldValue > maxVal) || (!le && fieldValue == maxVal) {
-				return errs.I18nNew(ctx, "sprout.params.out-of-range", struValue.Type().Field(fieldIdx).Name, minVal, maxVal).WithStatus(http.StatusBadRequest)
+			seen[key] = struct{}{}
+			return nil
+		}
+		if fieldValue.Kind() == reflect.Map {
+			iter := fieldValue.MapRange()
+			for iter.Next() {
+				if err := checkItem(iter.Value()); err != nil {
+					return err
+				}
 			}
 			return nil
 		}
-	default:
+		for i := 0; i < n; i++ {
+			if err := checkItem(fieldValue.Index(i)); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 }
 
-type StringLengthValidator struct{}
+// CrossFieldValidator validates a field against the other fields of the struct, which are referred by their names:
+//
+//	required_if=Type:card,Status:active  the field is required if all the fields have the values
+//	required_unless=Type:cash            the field is required unless all the fields have the values
+//	excluded_if=Type:cash                the field must be empty if all the fields have the values
+//	excluded_with=Phone,Email            the field must be empty if any of the fields is present
+//	eqfield=Password, nefield=OldPassword
+//	gtfield=StartDate, gtefield=, ltfield=, ltefield=
+//
+// The comparisons are skipped if the field is zero, which is left to the required rules, gtfield and the like
+// are also skipped if the other field is zero. Unknown field names are reported when the validators are built.
+type CrossFieldValidator struct{}
 
-func (s *StringLengthValidator) ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc {
-	var bottom, upper string
-	var ge, le bool
+func (c *CrossFieldValidator) ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc {
+	var funcs []ValidateFunc
 	for _, frag := range strings.Split(validateTag, ";") {
-		frag = strings.TrimSpace(frag)
-		if (strings.HasPrefix(frag, "[") || strings.HasPrefix(frag, "(")) && (strings.HasSuffix(frag, "]") || strings.HasSuffix(frag, ")")) {
-			ranges := strings.Split(frag[1:len(frag)-1], ",")
-			if len(ranges) != 2 {
-				return nil
-			}
-			bottom = strings.TrimSpace(ranges[0])
-			upper = strings.TrimSpace(ranges[1])
-			if strings.HasPrefix(frag, "[") {
-				ge = true
-			}
-			if strings.HasSuffix(frag, "]") {
-				le = true
-			}
-			break
+		rule, arg, ok := strings.Cut(strings.TrimSpace(frag), "=")
+		if !ok {
+			continue
+		}
+		switch rule {
+		case "required_if", "required_unless", "excluded_if":
+			funcs = append(funcs, conditionValidateFunc(rule, arg, fieldIdx, struType))
+		case "excluded_with":
+			funcs = append(funcs, excludedWithValidateFunc(arg, fieldIdx, struType))
+		case "eqfield", "nefield", "gtfield", "gtefield", "ltfield", "ltefield":
+			funcs = append(funcs, compareFieldValidateFunc(rule, arg, fieldIdx, struType))
 		}
 	}
-	if bottom == "" && upper == "" {
-		return nil
+	return chainValidateFuncs(funcs)
+}
+
+// lookupReferredField looks up the field referred by the validate tag of another field, it panics if absent
+func lookupReferredField(struType reflect.Type, fieldIdx int, name string) reflect.StructField {
+	f, ok := struType.FieldByName(name)
+	if !ok || name == "" {
+		panic(errs.New("The field [{0}] referred by the validate tag of {1}.{2} does not exist", name, struType.Name(), struType.Field(fieldIdx).Name))
 	}
-	field := struType.Field(fieldIdx)
-	if field.Type.Kind() != reflect.String {
-		return nil
+	return f
+}
+
+// referredFieldValue returns the value of the referred field, dereferenced, and invalid if it is nil
+func referredFieldValue(struValue reflect.Value, index []int) reflect.Value {
+	v, err := struValue.FieldByIndexErr(index)
+	if err != nil {
+		return reflect.Value{}
 	}
-	var minLen, maxLen int
-	var err error
-	if bottom != "" {
-		minLen, err = strconv.Atoi(bottom)
-		if err != nil {
-			panic(errs.New("The min length [{0}] of {1}.{2} is invalid", bottom, struType.Name(), field.Name))
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
 		}
+		v = v.Elem()
 	}
-	if upper != "" {
-		maxLen, err = strconv.Atoi(upper)
-		if err != nil {
-			panic(errs.New("The max length [{0}] of {1}.{2} is invalid", upper, struType.Name(), field.Name))
+	return v
+}
+
+func isZeroValue(v reflect.Value) bool {
+	return !v.IsValid() || v.IsZero()
+}
+
+func conditionValidateFunc(rule, arg string, fieldIdx int, struType reflect.Type) ValidateFunc {
+	type condition struct {
+		index []int
+		value string
+	}
+	var conds []condition
+	var referred []reflect.StructField
+	for _, pair := range strings.Split(arg, ",") {
+		name, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			panic(errs.New("The condition [{0}] of {1}.{2} should be like Field:value", pair, struType.Name(), struType.Field(fieldIdx).Name))
 		}
+		f := lookupReferredField(struType, fieldIdx, strings.TrimSpace(name))
+		conds = append(conds, condition{index: f.Index, value: strings.TrimSpace(value)})
+		referred = append(referred, f)
 	}
+	field := struType.Field(fieldIdx)
 	return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
-		fieldValue := struValue.Field(fieldIdx).String()
-		fieldLen := utf8.RuneCountInString(fieldValue)
-		if minLen > 0 {
-			if (fieldLen < minLen) || (!ge && fieldLen == minLen) {
-				return errs.I18nNew(ctx, "sprout.params.out-of-length", field.Name, minLen, maxLen).WithStatus(http.StatusBadRequest)
+		matched := true
+		for _, cond := range conds {
+			v := referredFieldValue(struValue, cond.index)
+			str := ""
+			if v.IsValid() {
+				str = fmt.Sprint(v.Interface())
+			}
+			if str != cond.value {
+				matched = false
+				break
 			}
 		}
-		if maxLen > 0 {
-			if (fieldLen > maxLen) || (!le && fieldLen == maxLen) {
-				return errs.I18nNew(ctx, "sprout.params.out-of-length", field.Name, minLen, maxLen).WithStatus(http.StatusBadRequest)
+		zero := isZeroValue(referredFieldValue(struValue, []int{fieldIdx}))
+		switch rule {
+		case "required_if":
+			if matched && zero {
+				return ruleError(ctx, rule, "sprout.params.required", fieldLabel(ctx, field))
+			}
+		case "required_unless":
+			if !matched && zero {
+				return ruleError(ctx, rule, "sprout.params.required", fieldLabel(ctx, field))
+			}
+		case "excluded_if":
+			if matched && !zero {
+				return ruleError(ctx, rule, "sprout.params.excluded", fieldLabel(ctx, field), fieldLabels(ctx, referred))
 			}
 		}
 		return nil
 	}
 }
 
-type EmailValidator struct{}
+func excludedWithValidateFunc(arg string, fieldIdx int, struType reflect.Type) ValidateFunc {
+	var referred []reflect.StructField
+	for _, name := range strings.Split(arg, ",") {
+		referred = append(referred, lookupReferredField(struType, fieldIdx, strings.TrimSpace(name)))
+	}
+	field := struType.Field(fieldIdx)
+	return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
+		if isZeroValue(referredFieldValue(struValue, []int{fieldIdx})) {
+			return nil
+		}
+		for _, f := range referred {
+			if !isZeroValue(referredFieldValue(struValue, f.Index)) {
+				return ruleError(ctx, "excluded_with", "sprout.params.excluded", fieldLabel(ctx, field), fieldLabels(ctx, referred))
+			}
+		}
+		return nil
+	}
+}
 
-func (e *EmailValidator) ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc {
-	for _, frag := range strings.Split(validateTag, ";") {
-		frag = strings.TrimSpace(frag)
-		if frag == "email" {
-			return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
-				fieldValue := struValue.Field(fieldIdx).String()
-				if !emailRegex.MatchString(fieldValue) {
-					return errs.I18nNew(ctx, "sprout.params.invalid-email", fieldValue).WithStatus(http.StatusBadRequest)
-				}
+func compareFieldValidateFunc(rule, name string, fieldIdx int, struType reflect.Type) ValidateFunc {
+	name = strings.TrimSpace(name)
+	field := struType.Field(fieldIdx)
+	other := lookupReferredField(struType, fieldIdx, name)
+	fieldType := derefType(field.Type)
+	if fieldType != derefType(other.Type) {
+		panic(errs.New("The field {0}.{1} can not be compared with the field [{2}] of another type", struType.Name(), field.Name, name))
+	}
+	if rule == "eqfield" || rule == "nefield" {
+		if !fieldType.Comparable() {
+			panic(errs.New("The field {0}.{1} is not comparable", struType.Name(), field.Name))
+		}
+	} else if compareValues(reflect.Zero(fieldType), reflect.Zero(fieldType)) == compareUnsupported {
+		panic(errs.New("The field {0}.{1} is not ordered to be compared", struType.Name(), field.Name))
+	}
+	key := "sprout.params." + strings.TrimSuffix(rule, "field") + "-field"
+	return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
+		v := referredFieldValue(struValue, []int{fieldIdx})
+		if isZeroValue(v) {
+			return nil
+		}
+		ov := referredFieldValue(struValue, other.Index)
+		var ok bool
+		switch rule {
+		case "eqfield":
+			ok = ov.IsValid() && v.Interface() == ov.Interface()
+		case "nefield":
+			ok = !ov.IsValid() || v.Interface() != ov.Interface()
+		default:
+			if isZeroValue(ov) {
 				return nil
 			}
+			c := compareValues(v, ov)
+			ok = (rule == "gtfield" && c > 0) || (rule == "gtefield" && c >= 0) ||
+				(rule == "ltfield" && c < 0) || (rule == "ltefield" && c <= 0)
+		}
+		if !ok {
+			return ruleError(ctx, rule, key, fieldLabel(ctx, field), fieldLabel(ctx, other))
 		}
+		return nil
 	}
-	return nil
+}
+
+const compareUnsupported = 2
+
+// compareValues compares the numbers, strings and times of the same type, compareUnsupported is returned
+// for the other types
+func compareValues(a, b reflect.Value) int {
+	if a.Type() == typeTime {
+		return a.Interface().(time.Time).Compare(b.Interface().(time.Time))
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp.Compare(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cmp.Compare(a.Uint(), b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return cmp.Compare(a.Float(), b.Float())
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	}
+	return compareUnsupported
 }
@@ -0,0 +1,216 @@
+package sprout
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wxy365/basal/errs"
+)
+
+var (
+	uuidRegex     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hostnameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*\.?$`)
+	e164Regex     = regexp.MustCompile(`^\+[1-9]\d{1,14}$`)
+	hexRegex      = regexp.MustCompile(`^(0[xX])?[0-9a-fA-F]+$`)
+	semverRegex   = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+		`(-((0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(\.(0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+		`(\+([0-9a-zA-Z-]+(\.[0-9a-zA-Z-]+)*))?$`)
+)
+
+// formatChecker checks a format of the string values, key is the i18n key of the message
+type formatChecker struct {
+	key   string
+	check func(s string) bool
+}
+
+var formatCheckers = map[string]formatChecker{
+	"url":      {"sprout.params.invalid-url", isURL},
+	"uuid":     {"sprout.params.invalid-uuid", uuidRegex.MatchString},
+	"ip":       {"sprout.params.invalid-ip", isIP(func(a netip.Addr) bool { return true })},
+	"ipv4":     {"sprout.params.invalid-ip", isIP(netip.Addr.Is4)},
+	"ipv6":     {"sprout.params.invalid-ip", isIP(netip.Addr.Is6)},
+	"cidr":     {"sprout.params.invalid-cidr", isCIDR},
+	"hostname": {"sprout.params.invalid-hostname", isHostname},
+	"e164":     {"sprout.params.invalid-e164", e164Regex.MatchString},
+	"base64":   {"sprout.params.invalid-base64", isBase64},
+	"hex":      {"sprout.params.invalid-hex", hexRegex.MatchString},
+	"json":     {"sprout.params.invalid-json", func(s string) bool { return json.Valid([]byte(s)) }},
+	"semver":   {"sprout.params.invalid-semver", semverRegex.MatchString},
+	"iso3166":  {"sprout.params.invalid-country", func(s string) bool { return iso3166Codes[s] }},
+	"iso4217":  {"sprout.params.invalid-currency", func(s string) bool { return iso4217Codes[s] }},
+}
+
+// FormatValidator validates the formats of the string fields with the rules:
+//
+//	url        absolute URL with scheme and host
+//	uuid       UUID in the 8-4-4-4-12 form
+//	ip, ipv4, ipv6, cidr
+//	hostname   RFC 1123 host name
+//	e164       phone number like +8613800000000
+//	base64, hex, json, semver
+//	iso3166    ISO 3166-1 alpha-2 country code, eg. CN
+//	iso4217    ISO 4217 currency code, eg. CNY
+//	oneof=a b c          one of the space separated values, also for the number fields
+//	regex=^[a-z]+$       matching the regular expression, which should not contain ';'
+//	datetime=2006-01-02  time in the Go layout
+//
+// Empty values are left to the required rule.
+type FormatValidator struct{}
+
+func (f *FormatValidator) ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc {
+	field := struType.Field(fieldIdx)
+	var funcs []ValidateFunc
+	for _, frag := range strings.Split(validateTag, ";") {
+		frag = strings.TrimSpace(frag)
+		rule, arg, _ := strings.Cut(frag, "=")
+		var vdFunc ValidateFunc
+		if checker, exists := formatCheckers[frag]; exists {
+			vdFunc = formatValidateFunc(frag, checker.key, checker.check, "")
+		} else {
+			switch rule {
+			case "oneof":
+				vdFunc = oneOfValidateFunc(arg, fieldIdx, struType)
+			case "regex":
+				re, err := regexp.Compile(arg)
+				if err != nil {
+					panic(errs.Wrap(err, "The regex of {0}.{1} is invalid", struType.Name(), field.Name))
+				}
+				vdFunc = formatValidateFunc(rule, "sprout.params.mismatched-regex", re.MatchString, arg)
+			case "datetime":
+				if arg == "" {
+					panic(errs.New("The datetime layout of {0}.{1} is absent", struType.Name(), field.Name))
+				}
+				vdFunc = formatValidateFunc(rule, "sprout.params.invalid-datetime", func(s string) bool {
+					_, err := time.Parse(arg, s)
+					return err == nil
+				}, arg)
+			default:
+				continue
+			}
+		}
+		if rule != "oneof" && derefType(field.Type).Kind() != reflect.String {
+			panic(errs.New("The rule [{0}] of {1}.{2} only applies to strings", rule, struType.Name(), field.Name))
+		}
+		funcs = append(funcs, vdFunc)
+	}
+	return chainValidateFuncs(funcs)
+}
+
+func formatValidateFunc(rule, key string, check func(s string) bool, arg string) ValidateFunc {
+	return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
+		s, ok := formatString(struValue.Field(fieldIdx))
+		if ok && !check(s) {
+			if arg != "" {
+				return ruleError(ctx, rule, key, fieldLabel(ctx, struValue.Type().Field(fieldIdx)), arg)
+			}
+			return ruleError(ctx, rule, key, fieldLabel(ctx, struValue.Type().Field(fieldIdx)))
+		}
+		return nil
+	}
+}
+
+func oneOfValidateFunc(arg string, fieldIdx int, struType reflect.Type) ValidateFunc {
+	field := struType.Field(fieldIdx)
+	options := strings.Fields(arg)
+	if len(options) == 0 {
+		panic(errs.New("The options of the oneof rule of {0}.{1} are absent", struType.Name(), field.Name))
+	}
+	switch derefType(field.Type).Kind() {
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		panic(errs.New("The oneof rule of {0}.{1} only applies to strings and integers", struType.Name(), field.Name))
+	}
+	return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
+		v := referredFieldValue(struValue, []int{fieldIdx})
+		if isZeroValue(v) {
+			return nil
+		}
+		var s string
+		if v.Kind() == reflect.String {
+			s = v.String()
+		} else {
+			s = fmt.Sprint(v.Interface())
+		}
+		for _, option := range options {
+			if s == option {
+				return nil
+			}
+		}
+		return ruleError(ctx, "oneof", "sprout.params.not-one-of", fieldLabel(ctx, field), strings.Join(options, ", "))
+	}
+}
+
+// formatString returns the string of the field value, false if it is nil or empty
+func formatString(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.String || v.Len() == 0 {
+		return "", false
+	}
+	return v.String(), true
+}
+
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+func isIP(is func(netip.Addr) bool) func(s string) bool {
+	return func(s string) bool {
+		addr, err := netip.ParseAddr(s)
+		return err == nil && addr.Zone() == "" && is(addr)
+	}
+}
+
+func isCIDR(s string) bool {
+	_, err := netip.ParsePrefix(s)
+	return err == nil
+}
+
+func isHostname(s string) bool {
+	return len(s) <= 253 && hostnameRegex.MatchString(s)
+}
+
+func isBase64(s string) bool {
+	_, err := base64.StdEncoding.DecodeString(s)
+	return err == nil
+}
+
+var iso3166Codes = codeSet(`
+AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ
+CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR
+GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP
+KE KG KH KI KM KN KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS
+MT MU MV MW MX MY MZ NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS PT PW PY QA RE RO RS
+RU RW SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW
+TZ UA UG UM US UY UZ VA VC VE VG VI VN VU WF WS YE YT ZA ZM ZW`)
+
+var iso4217Codes = codeSet(`
+AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BOV BRL BSD BTN BWP BYN BZD CAD CDF
+CHE CHF CHW CLF CLP CNY COP COU CRC CUC CUP CVE CZK DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD
+GNF GTQ GYD HKD HNL HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD KZT LAK LBP LKR
+LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV MYR MZN NAD NGN NIO NOK NPR NZD OMR PAB PEN PGK
+PHP PKR PLN PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD SHP SLE SLL SOS SRD SSP STN SVC SYP SZL THB TJS TMT
+TND TOP TRY TTD TWD TZS UAH UGX USD USN UYI UYU UYW UZS VED VES VND VUV WST XAF XAG XAU XBA XBB XBC XBD XCD XCG
+XDR XOF XPD XPF XPT XSU XTS XUA XXX YER ZAR ZMW ZWG ZWL`)
+
+func codeSet(codes string) map[string]bool {
+	set := make(map[string]bool)
+	for _, code := range strings.Fields(codes) {
+		set[code] = true
+	}
+	return set
+}
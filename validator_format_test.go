@@ -0,0 +1,126 @@
+package sprout
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// formatTestInput returns an input whose only field, named value, has the validate tag and the value
+func formatTestInput(validateTag string, value any) any {
+	t := reflect.StructOf([]reflect.StructField{{
+		Name: "Value",
+		Type: reflect.TypeOf(value),
+		Tag:  reflect.StructTag(`json:"value" validate:"` + validateTag + `"`),
+	}})
+	v := reflect.New(t).Elem()
+	v.Field(0).Set(reflect.ValueOf(value))
+	return v.Interface()
+}
+
+func TestFormatValidator(t *testing.T) {
+	for _, c := range []struct {
+		rule    string
+		valid   []string
+		invalid []string
+	}{
+		{"email", []string{"a@example.com", "a.b+tag@mail.example.org"}, []string{"a", "a@", "@example.com", "a@example", "a b@example.com"}},
+		{"url", []string{"https://example.com", "http://localhost:8080/a?b=c"}, []string{"example.com", "/path", "https://", "mailto:a@example.com"}},
+		{"uuid", []string{"123e4567-e89b-12d3-a456-426614174000", "123E4567-E89B-12D3-A456-426614174000"}, []string{"123e4567e89b12d3a456426614174000", "123e4567-e89b-12d3-a456-42661417400g"}},
+		{"ip", []string{"127.0.0.1", "::1"}, []string{"256.0.0.1", "localhost", "127.0.0.1/8"}},
+		{"ipv4", []string{"10.0.0.1"}, []string{"::1", "10.0.0"}},
+		{"ipv6", []string{"2001:db8::1"}, []string{"10.0.0.1"}},
+		{"cidr", []string{"10.0.0.0/8", "2001:db8::/32"}, []string{"10.0.0.1", "10.0.0.0/33"}},
+		{"hostname", []string{"example.com", "localhost", "a-b.example.com."}, []string{"-a.example.com", "a_b.example.com", "example..com"}},
+		{"e164", []string{"+8613800000000", "+14155552671"}, []string{"13800000000", "+0123", "+1234567890123456"}},
+		{"base64", []string{"c3Byb3V0", "c3Byb3V0IQ=="}, []string{"c3Byb3V0IQ", "not base64!"}},
+		{"hex", []string{"deadBEEF", "0x1f"}, []string{"0x", "xyz"}},
+		{"json", []string{`{"a":1}`, `[1,2]`, `"s"`}, []string{`{a:1}`, `[1,`}},
+		{"semver", []string{"1.0.0", "1.2.3-beta.1+build.5"}, []string{"1.0", "01.0.0", "v1.0.0"}},
+		{"iso3166", []string{"CN", "US"}, []string{"cn", "XX", "CHN"}},
+		{"iso4217", []string{"CNY", "USD"}, []string{"cny", "XXY", "US"}},
+		{"oneof=red green", []string{"red", "green"}, []string{"blue", "Red"}},
+		{"regex=^[a-z]+$", []string{"abc"}, []string{"abc1", "ABC"}},
+		{"datetime=2006-01-02", []string{"2026-10-17"}, []string{"2026-13-01", "17/10/2026"}},
+	} {
+		rule, _, _ := strings.Cut(c.rule, "=")
+		for _, s := range c.valid {
+			if failed := validateInput(t, formatTestInput(c.rule, s), ValidationAggregate); failed != nil {
+				t.Errorf("%s: expected %q to be valid, got %v", c.rule, s, failed)
+			}
+		}
+		for _, s := range c.invalid {
+			if failed := validateInput(t, formatTestInput(c.rule, s), ValidationAggregate); !slices.Equal(failed, []string{"value " + rule}) {
+				t.Errorf("%s: expected %q to be invalid, got %v", c.rule, s, failed)
+			}
+		}
+		// empty values are left to the required rule
+		if failed := validateInput(t, formatTestInput(c.rule, ""), ValidationAggregate); failed != nil {
+			t.Errorf("%s: expected the empty value to be skipped, got %v", c.rule, failed)
+		}
+		var nilValue *string
+		if failed := validateInput(t, formatTestInput(c.rule, nilValue), ValidationAggregate); failed != nil {
+			t.Errorf("%s: expected the nil value to be skipped, got %v", c.rule, failed)
+		}
+		s := c.invalid[0]
+		if failed := validateInput(t, formatTestInput(c.rule, &s), ValidationAggregate); !slices.Equal(failed, []string{"value " + rule}) {
+			t.Errorf("%s: expected the pointer to %q to be invalid, got %v", c.rule, s, failed)
+		}
+	}
+}
+
+func TestFormatValidatorOneOfNumbers(t *testing.T) {
+	for value, expected := range map[int][]string{
+		1: nil,
+		3: nil,
+		// zero values are left to the required rule
+		0: nil,
+		2: {"value oneof"},
+	} {
+		if failed := validateInput(t, formatTestInput("oneof=1 3", value), ValidationAggregate); !slices.Equal(failed, expected) {
+			t.Errorf("%d: expected %v, got %v", value, expected, failed)
+		}
+	}
+}
+
+func TestFormatValidatorRules(t *testing.T) {
+	for _, c := range []struct {
+		rule  string
+		value any
+	}{
+		{"uuid", 1},
+		{"regex=[", ""},
+		{"regex=^a$", 1},
+		{"datetime=", ""},
+		{"oneof=", ""},
+		{"oneof=1 2", 1.5},
+	} {
+		if err := buildValidateError(formatTestInput(c.rule, c.value)); err == nil {
+			t.Errorf("%s: expected the rule to be rejected for %T", c.rule, c.value)
+		}
+	}
+}
+
+func TestFormatValidatorMessages(t *testing.T) {
+	keys := []string{"sprout.params.invalid-email", "sprout.params.not-one-of", "sprout.params.mismatched-regex", "sprout.params.invalid-datetime"}
+	for _, checker := range formatCheckers {
+		keys = append(keys, checker.key)
+	}
+	for _, name := range []string{"i18n/sprout_en.json", "i18n/sprout_zh.json"} {
+		raw, err := fs.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages := make(map[string]string)
+		if err = json.Unmarshal(raw, &messages); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range keys {
+			if messages[key] == "" {
+				t.Errorf("%s: the message of [%s] is absent", name, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package sprout
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wxy365/basal/errs"
+)
+
+// RangeValidator validates the values of the number fields with the rules:
+//
+//	min=1, max=10
+//	range=[1,10)    the bounds are inclusive with [ and ], exclusive with ( and ), and absent if empty, eg. range=(0,]
+//	between=1,10    the same as range=[1,10]
+//
+// Zero values are validated as well, nil pointers are left to the required rule.
+type RangeValidator struct{}
+
+func (r *RangeValidator) ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc {
+	var funcs []ValidateFunc
+	for _, frag := range strings.Split(validateTag, ";") {
+		rule, arg, _ := strings.Cut(strings.TrimSpace(frag), "=")
+		arg = strings.TrimSpace(arg)
+		var iv interval
+		ok := arg != ""
+		switch rule {
+		case "min":
+			iv = interval{lower: arg}
+		case "max":
+			iv = interval{upper: arg}
+		case "range":
+			iv, ok = parseInterval(arg)
+		case "between":
+			var lower, upper string
+			lower, upper, ok = strings.Cut(arg, ",")
+			iv = interval{lower: strings.TrimSpace(lower), upper: strings.TrimSpace(upper)}
+		default:
+			continue
+		}
+		if !ok {
+			panic(errs.New("The rule [{0}] of {1}.{2} is invalid", frag, struType.Name(), struType.Field(fieldIdx).Name))
+		}
+		funcs = append(funcs, rangeValidateFunc(rule, iv, fieldIdx, struType))
+	}
+	return chainValidateFuncs(funcs)
+}
+
+func rangeValidateFunc(rule string, iv interval, fieldIdx int, struType reflect.Type) ValidateFunc {
+	field := struType.Field(fieldIdx)
+	check, err := numberIntervalCheck(iv, derefType(field.Type).Kind())
+	if err != nil {
+		panic(errs.Wrap(err, "The rule [{0}] of {1}.{2} is invalid", rule, struType.Name(), field.Name))
+	}
+	key, arg := "sprout.params.not-in-range", iv.String()
+	switch {
+	case iv.upper == "" && !iv.lowerOpen:
+		key, arg = "sprout.params.too-small", iv.lower
+	case iv.lower == "" && !iv.upperOpen:
+		key, arg = "sprout.params.too-large", iv.upper
+	}
+	return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
+		v := referredFieldValue(struValue, []int{fieldIdx})
+		if v.IsValid() && !check(v) {
+			return ruleError(ctx, rule, key, fieldLabel(ctx, field), arg)
+		}
+		return nil
+	}
+}
+
+// LengthValidator validates the lengths of the string, slice, array and map fields with the rules:
+//
+//	len=8           exact length
+//	len=[1,10)      length in the range, with the same syntax as the range rule
+//	min_len=1, max_len=10
+//
+// The lengths of strings are counted in characters, and the ones of []byte in bytes. Empty values are validated
+// as well, nil pointers are left to the required rule.
+type LengthValidator struct{}
+
+func (l *LengthValidator) ValidateFunc(validateTag string, fieldIdx int, struType reflect.Type) ValidateFunc {
+	var funcs []ValidateFunc
+	for _, frag := range strings.Split(validateTag, ";") {
+		rule, arg, _ := strings.Cut(strings.TrimSpace(frag), "=")
+		arg = strings.TrimSpace(arg)
+		var iv interval
+		ok := arg != ""
+		switch rule {
+		case "len":
+			if strings.HasPrefix(arg, "[") || strings.HasPrefix(arg, "(") {
+				iv, ok = parseInterval(arg)
+			} else {
+				iv = interval{lower: arg, upper: arg}
+			}
+		case "min_len":
+			iv = interval{lower: arg}
+		case "max_len":
+			iv = interval{upper: arg}
+		default:
+			continue
+		}
+		if !ok {
+			panic(errs.New("The rule [{0}] of {1}.{2} is invalid", frag, struType.Name(), struType.Field(fieldIdx).Name))
+		}
+		funcs = append(funcs, lengthValidateFunc(rule, iv, fieldIdx, struType))
+	}
+	return chainValidateFuncs(funcs)
+}
+
+func lengthValidateFunc(rule string, iv interval, fieldIdx int, struType reflect.Type) ValidateFunc {
+	field := struType.Field(fieldIdx)
+	switch derefType(field.Type).Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+	default:
+		panic(errs.New("The rule [{0}] of {1}.{2} only applies to strings, slices, arrays and maps", rule, struType.Name(), field.Name))
+	}
+	check, err := numberIntervalCheck(iv, reflect.Int)
+	if err != nil {
+		panic(errs.Wrap(err, "The rule [{0}] of {1}.{2} is invalid", rule, struType.Name(), field.Name))
+	}
+	key, arg := "sprout.params.length-not-in-range", iv.String()
+	switch {
+	case iv.lower == iv.upper:
+		key, arg = "sprout.params.wrong-length", iv.lower
+	case iv.upper == "" && !iv.lowerOpen:
+		key, arg = "sprout.params.too-short", iv.lower
+	case iv.lower == "" && !iv.upperOpen:
+		key, arg = "sprout.params.too-long", iv.upper
+	}
+	return func(ctx context.Context, fieldIdx int, struValue reflect.Value) error {
+		v := referredFieldValue(struValue, []int{fieldIdx})
+		if !v.IsValid() {
+			return nil
+		}
+		n := v.Len()
+		if v.Kind() == reflect.String {
+			n = utf8.RuneCountInString(v.String())
+		}
+		if !check(reflect.ValueOf(n)) {
+			return ruleError(ctx, rule, key, fieldLabel(ctx, field), arg)
+		}
+		return nil
+	}
+}
+
+// interval is a range like [1,10), the bounds are absent if empty
+type interval struct {
+	lower, upper         string
+	lowerOpen, upperOpen bool
+}
+
+// parseInterval parses the intervals like [1,10], (0,1) or [1,)
+func parseInterval(s string) (interval, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < 3 || (s[0] != '[' && s[0] != '(') || (s[len(s)-1] != ']' && s[len(s)-1] != ')') {
+		return interval{}, false
+	}
+	lower, upper, ok := strings.Cut(s[1:len(s)-1], ",")
+	if !ok || strings.Contains(upper, ",") {
+		return interval{}, false
+	}
+	return interval{
+		lower:     strings.TrimSpace(lower),
+		upper:     strings.TrimSpace(upper),
+		lowerOpen: s[0] == '(',
+		upperOpen: s[len(s)-1] == ')',
+	}, true
+}
+
+func (iv interval) String() string {
+	lower, upper := "[", "]"
+	if iv.lowerOpen || iv.lower == "" {
+		lower = "("
+	}
+	if iv.upperOpen || iv.upper == "" {
+		upper = ")"
+	}
+	lowerBound, upperBound := iv.lower, iv.upper
+	if lowerBound == "" {
+		lowerBound = "-∞"
+	}
+	if upperBound == "" {
+		upperBound = "+∞"
+	}
+	return lower + lowerBound + ", " + upperBound + upper
+}
+
+// numberIntervalCheck builds the function checking whether the numbers of the kind are in the interval
+func numberIntervalCheck(iv interval, kind reflect.Kind) (func(v reflect.Value) bool, error) {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		check, err := intervalCheck(iv, func(s string) (int64, error) { return strconv.ParseInt(s, 10, 64) })
+		return func(v reflect.Value) bool { return check(v.Int()) }, err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		check, err := intervalCheck(iv, func(s string) (uint64, error) { return strconv.ParseUint(s, 10, 64) })
+		return func(v reflect.Value) bool { return check(v.Uint()) }, err
+	case reflect.Float32, reflect.Float64:
+		check, err := intervalCheck(iv, func(s string) (float64, error) { return strconv.ParseFloat(s, 64) })
+		return func(v reflect.Value) bool { return check(v.Float()) }, err
+	}
+	return nil, errs.New("The range rules only apply to numbers, use the len rules for the lengths")
+}
+
+func intervalCheck[T int64 | uint64 | float64](iv interval, parse func(s string) (T, error)) (func(v T) bool, error) {
+	var lower, upper *T
+	if iv.lower != "" {
+		v, err := parse(iv.lower)
+		if err != nil {
+			return nil, errs.New("The lower bound [{0}] is invalid", iv.lower)
+		}
+		lower = &v
+	}
+	if iv.upper != "" {
+		v, err := parse(iv.upper)
+		if err != nil {
+			return nil, errs.New("The upper bound [{0}] is invalid", iv.upper)
+		}
+		upper = &v
+	}
+	if lower != nil && upper != nil && *lower > *upper {
+		return nil, errs.New("The lower bound [{0}] is greater than the upper bound [{1}]", iv.lower, iv.upper)
+	}
+	return func(v T) bool {
+		if lower != nil && (v < *lower || (iv.lowerOpen && v == *lower)) {
+			return false
+		}
+		if upper != nil && (v > *upper || (iv.upperOpen && v == *upper)) {
+			return false
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,152 @@
+package sprout
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestRangeValidator(t *testing.T) {
+	zero, five, eleven := 0, 5, 11
+	var nilInt *int
+	for _, c := range []struct {
+		rule    string
+		valid   []any
+		invalid []any
+	}{
+		// zero values are validated as well
+		{"min=1", []any{1, 10, &five, nilInt}, []any{0, -1, &zero}},
+		{"max=10", []any{10, 0, -1}, []any{11, &eleven}},
+		{"min=-1.5", []any{-1.5, 0.0, float32(2)}, []any{-1.6, float32(-2)}},
+		{"max=10", []any{uint(10), uint8(0)}, []any{uint(11), uint64(1 << 40)}},
+		{"range=[1,10]", []any{1, 10, &five}, []any{0, 11, &zero}},
+		{"range=(0,10)", []any{1, 9}, []any{0, 10}},
+		{"range=[0,1)", []any{0.0, 0.99}, []any{1.0, -0.01}},
+		{"range=(0,]", []any{0.01, 1e9}, []any{0.0, -1.0}},
+		{"range=[,0]", []any{0, -100}, []any{1}},
+		{"between=1,10", []any{1, 10}, []any{0, 11}},
+		// the legacy tags
+		{"[1,10]", []any{1, 10, 5.5}, []any{0, 11, 0.5}},
+		{"(0,1)", []any{0.5}, []any{0.0, 1.0}},
+	} {
+		for _, value := range c.valid {
+			if failed := validateInput(t, formatTestInput(c.rule, value), ValidationAggregate); failed != nil {
+				t.Errorf("%s: expected %v to be valid, got %v", c.rule, derefValue(value), failed)
+			}
+		}
+		for _, value := range c.invalid {
+			failed := validateInput(t, formatTestInput(c.rule, value), ValidationAggregate)
+			if len(failed) != 1 {
+				t.Errorf("%s: expected %v of %T to be invalid, got %v", c.rule, derefValue(value), value, failed)
+			}
+		}
+	}
+}
+
+func TestLengthValidator(t *testing.T) {
+	empty, long := "", "sprout"
+	var nilString *string
+	for _, c := range []struct {
+		rule    string
+		valid   []any
+		invalid []any
+	}{
+		// empty values are validated as well
+		{"min_len=1", []any{"a", []int{1}, map[string]int{"a": 1}, nilString}, []any{"", []int{}, map[string]int{}, &empty}},
+		{"max_len=3", []any{"", "abc", "中文字", []byte("abc"), [3]int{}}, []any{"abcd", []byte("中文"), [4]int{}, &long}},
+		{"len=2", []any{"ab", "中文", []string{"a", "b"}}, []any{"a", "abc", []string{"a"}}},
+		{"len=[1,3)", []any{"a", "ab"}, []any{"", "abc"}},
+		{"len=(1,]", []any{"ab", "abcdef"}, []any{"a", ""}},
+		// the legacy tags
+		{"[1,3]", []any{"a", "abc"}, []any{"", "abcd"}},
+	} {
+		for _, value := range c.valid {
+			if failed := validateInput(t, formatTestInput(c.rule, value), ValidationAggregate); failed != nil {
+				t.Errorf("%s: expected %v to be valid, got %v", c.rule, derefValue(value), failed)
+			}
+		}
+		for _, value := range c.invalid {
+			failed := validateInput(t, formatTestInput(c.rule, value), ValidationAggregate)
+			if len(failed) != 1 {
+				t.Errorf("%s: expected %v of %T to be invalid, got %v", c.rule, derefValue(value), value, failed)
+			}
+		}
+	}
+}
+
+func TestRangeValidatorRuleNames(t *testing.T) {
+	for rule, expected := range map[string]string{
+		"min=1":        "value min",
+		"range=[1,10]": "value range",
+		"between=1,10": "value between",
+		"[1,10]":       "value range",
+	} {
+		if failed := validateInput(t, formatTestInput(rule, 0), ValidationAggregate); !slices.Equal(failed, []string{expected}) {
+			t.Errorf("%s: expected %s, got %v", rule, expected, failed)
+		}
+	}
+	for rule, expected := range map[string]string{
+		"len=2":     "value len",
+		"min_len=2": "value min_len",
+		"[2,3]":     "value len",
+	} {
+		if failed := validateInput(t, formatTestInput(rule, "a"), ValidationAggregate); !slices.Equal(failed, []string{expected}) {
+			t.Errorf("%s: expected %s, got %v", rule, expected, failed)
+		}
+	}
+}
+
+func TestRangeValidatorRules(t *testing.T) {
+	for _, c := range []struct {
+		rule  string
+		value any
+	}{
+		{"min=", 0},
+		{"min=a", 0},
+		{"min=1.5", 0},
+		{"min=-1", uint(0)},
+		{"range=[1,10", 0},
+		{"range=[10,1]", 0},
+		{"between=1", 0},
+		// the ranges of the numbers and the lengths of the others are distinct rules
+		{"min=1", ""},
+		{"range=[1,10]", []int{}},
+		{"len=2", 0},
+		{"max_len=x", ""},
+		{"len=[3,1]", ""},
+	} {
+		if err := buildValidateError(formatTestInput(c.rule, c.value)); err == nil {
+			t.Errorf("%s: expected the rule to be rejected for %T", c.rule, c.value)
+		}
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	for s, expected := range map[string]interval{
+		"[1,10]":    {lower: "1", upper: "10"},
+		"(0, 1)":    {lower: "0", upper: "1", lowerOpen: true, upperOpen: true},
+		"[1,)":      {lower: "1", upperOpen: true},
+		" (,-1] ":   {upper: "-1", lowerOpen: true},
+		"[1.5,2.5)": {lower: "1.5", upper: "2.5", upperOpen: true},
+	} {
+		if iv, ok := parseInterval(s); !ok || iv != expected {
+			t.Errorf("%q: expected %+v, got %+v %v", s, expected, iv, ok)
+		}
+	}
+	for _, s := range []string{"", "[]", "[1]", "1,10", "[1,2,3]", "{1,2}"} {
+		if _, ok := parseInterval(s); ok {
+			t.Errorf("%q: expected an invalid interval", s)
+		}
+	}
+	if s := (interval{lower: "1", upperOpen: true}).String(); s != "[1, +∞)" {
+		t.Errorf("unexpected interval %s", s)
+	}
+}
+
+func derefValue(v any) any {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		return rv.Elem().Interface()
+	}
+	return v
+}
@@ -0,0 +1,387 @@
+package sprout
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/i18n"
+)
+
+// validateInput validates the input with the default validators, and returns the failed fields like "path rule"
+func validateInput(t *testing.T, in any, mode ValidationMode) []string {
+	t.Helper()
+	svr := newDefaultServer("test")
+	vf, err := svr.buildValidateFuncs("test", reflect.TypeOf(in), mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vf(i18n.WithLocale(context.Background(), "en"), reflect.ValueOf(in))
+	if err == nil {
+		return nil
+	}
+	var fieldErrs ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		t.Fatalf("expected the field errors, got %v", err)
+	}
+	failed := make([]string, len(fieldErrs))
+	for i, fe := range fieldErrs {
+		failed[i] = fe.Field + " " + fe.Rule
+	}
+	return failed
+}
+
+// buildValidateError returns the error reported when the validators of the input type are built
+func buildValidateError(in any) error {
+	_, err := newDefaultServer("test").buildValidateFuncs("test", reflect.TypeOf(in), ValidationDefault)
+	return err
+}
+
+type validateTestAddress struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"required;len=6"`
+}
+
+type validateTestInput struct {
+	Id      string               `path:"id" validate:"required"`
+	Page    int                  `query:"page" validate:"min=1"`
+	Name    string               `json:"name" validate:"required;min_len=2"`
+	Email   string               `json:"email,omitempty" validate:"email"`
+	Address validateTestAddress  `json:"address"`
+	Billing *validateTestAddress `json:"billing"`
+	Note    string               `validate:"max_len=4"`
+}
+
+func TestValidationAggregate(t *testing.T) {
+	in := validateTestInput{
+		Email:   "sprout",
+		Address: validateTestAddress{Zip: "123"},
+		Billing: &validateTestAddress{City: "Paris", Zip: "100000"},
+		Note:    "too long",
+	}
+	for _, c := range []struct {
+		mode     ValidationMode
+		expected []string
+	}{
+		{ValidationFailFast, []string{"id required"}},
+		// the default mode of the servers is fail-fast
+		{ValidationDefault, []string{"id required"}},
+		// the fields are named by their parameters or JSON names, every field reports its first failed rule
+		{ValidationAggregate, []string{
+			"id required",
+			"page min",
+			"name required",
+			"email email",
+			"address.city required",
+			"address.zip len",
+			"Note max_len",
+		}},
+	} {
+		if failed := validateInput(t, in, c.mode); !slices.Equal(failed, c.expected) {
+			t.Errorf("mode %d: expected %v, got %v", c.mode, c.expected, failed)
+		}
+	}
+	valid := validateTestInput{Id: "1", Page: 1, Name: "sprout", Address: validateTestAddress{City: "Paris", Zip: "100000"}}
+	if failed := validateInput(t, valid, ValidationAggregate); failed != nil {
+		t.Errorf("expected the input to be valid, got %v", failed)
+	}
+}
+
+func TestValidationProblem(t *testing.T) {
+	handler := func(ctx *Context, in validateTestInput) (string, error) { return in.Id, nil }
+	for _, c := range []struct {
+		name   string
+		svr    ValidationMode
+		ep     ValidationMode
+		fields int
+	}{
+		{"server default", ValidationDefault, ValidationDefault, 1},
+		{"server aggregate", ValidationAggregate, ValidationDefault, 2},
+		// the mode of the endpoint takes precedence
+		{"endpoint aggregate", ValidationFailFast, ValidationAggregate, 2},
+		{"endpoint fail-fast", ValidationAggregate, ValidationFailFast, 1},
+	} {
+		svr := newDefaultServer("test")
+		svr.ValidationMode = c.svr
+		mx := newServerTestMux(t, svr, &Endpoint[validateTestInput, string]{
+			Name:           "user",
+			Pattern:        "/users/{id}",
+			Methods:        []string{http.MethodPost},
+			Handler:        handler,
+			ValidationMode: c.ep,
+		})
+		r := httptest.NewRequest(http.MethodPost, "/users/1?page=0", strings.NewReader(`{"address":{"city":"Paris","zip":"100000"}}`))
+		r.Header.Set("Content-Type", MimeJson)
+		w := serve(mx, r)
+		if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != MimeProblemJson {
+			t.Errorf("%s: expected a 400 problem, got %d %s", c.name, w.Code, w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), `{"field":"page","rule":"min","message":"The Page should be at least 1"}`) {
+			t.Errorf("%s: expected the localized error of the page, got %s", c.name, w.Body.String())
+		}
+		if n := strings.Count(w.Body.String(), `"field"`); n != c.fields {
+			t.Errorf("%s: expected %d field errors, got %s", c.name, c.fields, w.Body.String())
+		}
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	if err := AddMessageBundle(localeTestBundle); err != nil {
+		t.Fatal(err)
+	}
+	vf, err := newDefaultServer("test").buildValidateFuncs("test", reflect.TypeOf(validateTestInput{}), ValidationDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the braces of the translation are not taken as placeholders
+	err = vf(i18n.WithLocale(context.Background(), "eo"), reflect.ValueOf(validateTestInput{}))
+	var leiErr *errs.Err
+	if !errors.As(err, &leiErr) || leiErr.Code != "sprout.params.invalid" || leiErr.Message != "Nevalidaj {parametroj} {0}" ||
+		leiErr.Status != http.StatusBadRequest {
+		t.Errorf("expected the translated message verbatim, got %v", err)
+	}
+	var fieldErrs ValidationErrors
+	if !errors.As(err, &fieldErrs) || len(fieldErrs) != 1 {
+		t.Errorf("expected the field errors as the cause, got %v", err)
+	}
+}
+
+func TestValidationErrorsAdd(t *testing.T) {
+	var fieldErrs ValidationErrors
+	fieldErrs.add("name", errs.New("Name is required").WithCode("required"))
+	fieldErrs.add("", errors.New("invalid"))
+	expected := ValidationErrors{
+		{Field: "name", Rule: "required", Message: "Name is required"},
+		{Message: "invalid"},
+	}
+	if !reflect.DeepEqual(fieldErrs, expected) {
+		t.Errorf("expected %+v, got %+v", expected, fieldErrs)
+	}
+}
+
+type validateTestItem struct {
+	Sku string `json:"sku" validate:"required"`
+	Qty int    `json:"qty" validate:"min=1"`
+}
+
+type validateTestOrder struct {
+	Items    []validateTestItem          `json:"items" validate:"min_items=1;max_items=3"`
+	Refs     []*validateTestItem         `json:"refs"`
+	Extras   map[string]validateTestItem `json:"extras"`
+	Tags     []string                    `json:"tags" validate:"unique;dive;required;max_len=3"`
+	Attrs    map[string]string           `json:"attrs" validate:"dive;keys;min_len=2;endkeys;required"`
+	Codes    [2]string                   `json:"codes" validate:"dive;oneof=a b"`
+	Lines    []validateTestItem          `json:"lines" validate:"unique=Sku"`
+	Matrix   [][]int                     `json:"matrix" validate:"dive;max_items=2;dive;min=0"`
+	Optional *[]string                   `json:"optional" validate:"min_items=1"`
+}
+
+func TestValidationCollections(t *testing.T) {
+	valid := validateTestOrder{Items: []validateTestItem{{Sku: "a", Qty: 1}}}
+	for _, c := range []struct {
+		name     string
+		order    func(o *validateTestOrder)
+		expected []string
+	}{
+		{"valid", func(o *validateTestOrder) {}, nil},
+		{"too few items", func(o *validateTestOrder) { o.Items = []validateTestItem{} }, []string{"items min_items"}},
+		// nil collections are left to the required rule
+		{"nil items", func(o *validateTestOrder) { o.Items = nil }, nil},
+		{"too many items", func(o *validateTestOrder) { o.Items = make([]validateTestItem, 4) }, []string{
+			"items max_items", "items[0].sku required", "items[0].qty min", "items[1].sku required", "items[1].qty min",
+			"items[2].sku required", "items[2].qty min", "items[3].sku required", "items[3].qty min",
+		}},
+		// the structs in the collections are validated without dive
+		{"struct items", func(o *validateTestOrder) {
+			o.Items = append(o.Items, validateTestItem{Qty: 1})
+			o.Refs = []*validateTestItem{nil, {Sku: "b"}}
+			o.Extras = map[string]validateTestItem{"y": {Qty: 1}, "x": {Sku: "c"}}
+		}, []string{"items[1].sku required", "refs[1].qty min", "extras[x].qty min", "extras[y].sku required"}},
+		{"dive", func(o *validateTestOrder) { o.Tags = []string{"a", "", "abcd", "a"} }, []string{"tags unique", "tags[1] required", "tags[2] max_len"}},
+		{"keys", func(o *validateTestOrder) { o.Attrs = map[string]string{"a": "1", "bb": ""} }, []string{"attrs[a] min_len", "attrs[bb] required"}},
+		{"arrays", func(o *validateTestOrder) { o.Codes = [2]string{"a", "c"} }, []string{"codes[1] oneof"}},
+		{"unique field", func(o *validateTestOrder) {
+			o.Lines = []validateTestItem{{Sku: "a", Qty: 1}, {Sku: "a", Qty: 2}}
+		}, []string{"lines unique"}},
+		{"nested dive", func(o *validateTestOrder) { o.Matrix = [][]int{{1, 2, 3}, {-1}} }, []string{"matrix[0] max_items", "matrix[1][0] min"}},
+		{"pointer to collection", func(o *validateTestOrder) { o.Optional = &[]string{} }, []string{"optional min_items"}},
+	} {
+		order := valid
+		c.order(&order)
+		if failed := validateInput(t, order, ValidationAggregate); !slices.Equal(failed, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, failed)
+		}
+	}
+}
+
+func TestValidationCollectionRules(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		input any
+	}{
+		{"dive on scalar", struct {
+			Name string `validate:"dive;required"`
+		}{}},
+		{"keys on slice", struct {
+			Tags []string `validate:"dive;keys;required;endkeys"`
+		}{}},
+		{"keys not closed", struct {
+			Attrs map[string]string `validate:"dive;keys;required"`
+		}{}},
+		{"items on scalar", struct {
+			Name string `validate:"min_items=1"`
+		}{}},
+		{"min greater than max", struct {
+			Tags []string `validate:"min_items=3;max_items=1"`
+		}{}},
+		{"invalid count", struct {
+			Tags []string `validate:"max_items=x"`
+		}{}},
+		{"unknown unique field", struct {
+			Items []validateTestItem `validate:"unique=Name"`
+		}{}},
+		{"incomparable items", struct {
+			Matrix [][]int `validate:"unique"`
+		}{}},
+	} {
+		if err := buildValidateError(c.input); err == nil {
+			t.Errorf("%s: expected the validate tag to be rejected", c.name)
+		}
+	}
+}
+
+type validateTestPayment struct {
+	Type     string    `json:"type" validate:"required;oneof=card cash"`
+	Card     string    `json:"card" validate:"required_if=Type:card;excluded_if=Type:cash"`
+	Receipt  string    `json:"receipt" validate:"required_unless=Type:card"`
+	Phone    string    `json:"phone"`
+	Email    string    `json:"email" validate:"excluded_with=Phone"`
+	Password string    `json:"password"`
+	Confirm  string    `json:"confirm" validate:"eqfield=Password"`
+	Previous string    `json:"previous" validate:"nefield=Password"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end" validate:"gtfield=Start"`
+	Min      *int      `json:"min"`
+	Max      *int      `json:"max" validate:"gtefield=Min"`
+}
+
+type validateTestRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+func (r *validateTestRange) Validate(ctx context.Context) error {
+	if r.To < r.From {
+		return ValidationErrors{{Field: "to", Rule: "range", Message: "to is before from"}}
+	}
+	if r.To-r.From > 10 {
+		return errs.New("The range is too wide").WithCode("width")
+	}
+	return nil
+}
+
+type validateTestSchedule struct {
+	Name  string              `json:"name" validate:"required"`
+	Range validateTestRange   `json:"range"`
+	Slots []validateTestRange `json:"slots"`
+}
+
+func TestValidationCrossField(t *testing.T) {
+	now := time.Now()
+	one, two := 1, 2
+	for _, c := range []struct {
+		name     string
+		payment  validateTestPayment
+		expected []string
+	}{
+		{"card", validateTestPayment{Type: "card", Card: "4242"}, nil},
+		{"card required", validateTestPayment{Type: "card"}, []string{"card required_if"}},
+		{"cash", validateTestPayment{Type: "cash", Receipt: "r1"}, nil},
+		{"card excluded", validateTestPayment{Type: "cash", Card: "4242", Receipt: "r1"}, []string{"card excluded_if"}},
+		{"receipt required", validateTestPayment{Type: "cash"}, []string{"receipt required_unless"}},
+		{"excluded with", validateTestPayment{Type: "card", Card: "4242", Phone: "1", Email: "a@b.c"}, []string{"email excluded_with"}},
+		{"equal fields", validateTestPayment{Type: "card", Card: "4242", Password: "p", Confirm: "p", Previous: "q"}, nil},
+		{"unequal fields", validateTestPayment{Type: "card", Card: "4242", Password: "p", Confirm: "q", Previous: "p"}, []string{"confirm eqfield", "previous nefield"}},
+		{"later time", validateTestPayment{Type: "card", Card: "4242", Start: now, End: now.Add(time.Hour)}, nil},
+		{"earlier time", validateTestPayment{Type: "card", Card: "4242", Start: now, End: now}, []string{"end gtfield"}},
+		// the comparisons are skipped if either field is zero
+		{"zero time", validateTestPayment{Type: "card", Card: "4242", End: now}, nil},
+		{"pointers", validateTestPayment{Type: "card", Card: "4242", Min: &two, Max: &one}, []string{"max gtefield"}},
+		{"nil pointer", validateTestPayment{Type: "card", Card: "4242", Max: &one}, nil},
+	} {
+		if failed := validateInput(t, c.payment, ValidationAggregate); !slices.Equal(failed, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, failed)
+		}
+	}
+}
+
+func TestValidationStructLevel(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		schedule validateTestSchedule
+		mode     ValidationMode
+		expected []string
+	}{
+		{"valid", validateTestSchedule{Name: "a", Range: validateTestRange{From: 1, To: 2}}, ValidationAggregate, nil},
+		// the field errors are relative to the struct, the other errors are reported on the struct
+		{"nested", validateTestSchedule{
+			Range: validateTestRange{From: 2, To: 1},
+			Slots: []validateTestRange{{From: 0, To: 1}, {From: 0, To: 20}},
+		}, ValidationAggregate, []string{"name required", "range.to range", "slots[1] width"}},
+		// the struct is validated after its fields
+		{"fail-fast", validateTestSchedule{Range: validateTestRange{From: 2, To: 1}}, ValidationFailFast, []string{"name required"}},
+		{"fail-fast struct", validateTestSchedule{Name: "a", Slots: []validateTestRange{{To: 20}, {To: 30}}}, ValidationFailFast, []string{"slots[0] width"}},
+	} {
+		if failed := validateInput(t, c.schedule, c.mode); !slices.Equal(failed, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, failed)
+		}
+	}
+	// the input itself
+	if failed := validateInput(t, validateTestRange{From: 0, To: 20}, ValidationAggregate); !slices.Equal(failed, []string{" width"}) {
+		t.Errorf("expected the error of the input, got %v", failed)
+	}
+}
+
+func TestValidationCrossFieldRules(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		input any
+	}{
+		{"unknown field", struct {
+			Password string
+			Confirm  string `validate:"eqfield=Pasword"`
+		}{}},
+		{"unknown condition field", struct {
+			Card string `validate:"required_if=Typ:card"`
+		}{}},
+		{"invalid condition", struct {
+			Type string
+			Card string `validate:"required_if=Type"`
+		}{}},
+		{"unknown excluded field", struct {
+			Email string `validate:"excluded_with=Phone"`
+		}{}},
+		{"unknown legacy field", struct {
+			Email string `validate:"either=Phone"`
+		}{}},
+		{"different types", struct {
+			Start time.Time
+			End   string `validate:"gtfield=Start"`
+		}{}},
+		{"unordered", struct {
+			A []int
+			B []int `validate:"gtfield=A"`
+		}{}},
+	} {
+		if err := buildValidateError(c.input); err == nil {
+			t.Errorf("%s: expected the validate tag to be rejected", c.name)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package sprout
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/wxy365/basal/errs"
+	"github.com/wxy365/basal/log"
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketHandler serves the upgraded connection, the connection is closed once the handler returns
+type WebSocketHandler[I any, M any] func(ctx *Context, in I, conn *WebSocketConn[M]) error
+
+// WebSocketEndpoint is an endpoint upgrading GET requests to WebSocket connections exchanging messages of type M.
+// The upgrade request is bound to I, validated and passed through the interceptors before upgrading.
+// The messages are encoded with the serializer negotiated by the Accept header, and decoded with the
+// deserializer of the Content-Type header, JSON is used if the headers are absent.
+type WebSocketEndpoint[I any, M any] struct {
+	Name    string
+	Pattern string
+	Handler WebSocketHandler[I, M]
+	// reports whether the upgrade request is allowed, if not set, only the requests without
+	// an Origin header or from the same origin are allowed
+	CheckOrigin func(r *http.Request) bool
+	// max size of the received messages in bytes, websocket.DefaultMaxPayloadBytes is used if zero
+	MaxMessageBytes int
+	// interceptors of this endpoint, see Endpoint.Interceptors
+	Interceptors []Interceptor
+	// whether to report all the invalid fields of the input, the mode of the server is used if not set
+	ValidationMode ValidationMode
+	// error handler for this endpoint, it only takes effect before upgrading
+	ErrorHandler
+}
+
+// WebSocketConn is a WebSocket connection exchanging messages of type M, every message is a single frame
+type WebSocketConn[M any] struct {
+	ws    *websocket.Conn
+	codec websocket.Codec
+}
+
+// Read blocks until a message is received
+func (c *WebSocketConn[M]) Read() (M, error) {
+	var msg M
+	err := c.codec.Receive(c.ws, &msg)
+	return msg, err
+}
+
+// Write sends a message, it is safe to be called concurrently with Read
+func (c *WebSocketConn[M]) Write(msg M) error {
+	return c.codec.Send(c.ws, msg)
+}
+
+func (c *WebSocketConn[M]) Close() error {
+	return c.ws.Close()
+}
+
+func (e *WebSocketEndpoint[I, M]) appendToServer(svr *Server, decrypters map[string]func(cipher []byte) ([]byte, error), g *Group) error {
+	inputType, err := inputStructType[I](e.Name)
+	if err != nil {
+		return err
+	}
+
+	r := &refinedEndpoint{
+		name:      e.Name,
+		pattern:   g.pattern(e.Pattern),
+		methods:   []string{http.MethodGet},
+		inputType: inputType,
+		websocket: true,
+	}
+
+	validateFunc, err := svr.buildValidateFuncs(e.Name, inputType, e.ValidationMode)
+	if err != nil {
+		return err
+	}
+
+	checkOrigin := e.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = isSameOrigin
+	}
+
+	httpHandler := func(ctx *Context) error {
+		if !strings.EqualFold(ctx.Request.Header.Get("Upgrade"), "websocket") {
+			return errs.New("Endpoint [{0}] only accepts WebSocket connections", r.name).WithStatus(http.StatusBadRequest)
+		}
+		if _, ok := ctx.Writer.(http.Hijacker); !ok || ctx.Request.ProtoMajor != 1 {
+			return errs.New("WebSocket is only supported over HTTP/1.1").WithStatus(http.StatusHTTPVersionNotSupported)
+		}
+		if !checkOrigin(ctx.Request) {
+			return errs.New("WebSocket origin [{0}] is not allowed", ctx.Request.Header.Get("Origin")).WithStatus(http.StatusForbidden)
+		}
+		in, err := parseInput[I](ctx, svr, r.name, decrypters, validateFunc)
+		if err != nil {
+			return err
+		}
+
+		codec := newWebSocketCodec(ctx)
+		websocket.Server{
+			Handler: func(ws *websocket.Conn) {
+				ws.MaxPayloadBytes = e.MaxMessageBytes
+				err := e.Handler(ctx, in, &WebSocketConn[M]{ws: ws, codec: codec})
+				if err != nil {
+					// the connection has been upgraded, the error can only be logged
+					log.ErrorErrF(`Endpoint [{0}] failed to process the WebSocket connection`, err, r.name)
+					markEndpointError(ctx, err)
+				}
+			},
+		}.ServeHTTP(ctx.Writer, ctx.Request)
+		return nil
+	}
+
+	r.httpHandler = svr.wrapHandler(r, g, e.Interceptors, e.ErrorHandler, httpHandler)
+	svr.endpoints = append(svr.endpoints, r)
+	return nil
+}
+
+// newWebSocketCodec encodes and decodes the messages with the serializers negotiated by the upgrade request,
+// the mux falls back to the JSON ones of the server if the media types are not supported
+func newWebSocketCodec(ctx *Context) websocket.Codec {
+	serializer, _ := ctx.Value(ctxKeySerializer).(Serializer)
+	acceptType, _ := ctx.Value(ctxKeyAcceptType).(string)
+	if serializer == nil {
+		serializer, acceptType = SerializeJson, MimeJson
+	}
+	deserializer, _ := ctx.Value(ctxKeyDeserializer).(Deserializer)
+	if deserializer == nil {
+		deserializer = DeserializeJson
+	}
+	payloadType := byte(websocket.BinaryFrame)
+	if strings.HasPrefix(acceptType, "text/") || acceptType == MimeJson {
+		payloadType = websocket.TextFrame
+	}
+
+	return websocket.Codec{
+		Marshal: func(v any) ([]byte, byte, error) {
+			buf := &bufferWriter{}
+			err := serializer(v, buf)
+			if err != nil {
+				return nil, 0, err
+			}
+			return buf.Bytes(), payloadType, nil
+		},
+		Unmarshal: func(data []byte, _ byte, v any) error {
+			r := ctx.Request.Clone(ctx.Request.Context())
+			r.Body = io.NopCloser(bytes.NewReader(data))
+			r.ContentLength = int64(len(data))
+			return deserializer(r, v)
+		},
+	}
+}
+
+func isSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,119 @@
+package sprout
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+type wsTestInput struct {
+	Room string `path:"room" validate:"required"`
+}
+
+type wsTestMessage struct {
+	Seq  int    `json:"seq"`
+	Text string `json:"text"`
+}
+
+func TestWebSocketEndpoint(t *testing.T) {
+	var trace []string
+	var serialized atomic.Int32
+	svr := newDefaultServer("test")
+	svr.Serializers = map[string]Serializer{
+		MimeJson: func(model any, w http.ResponseWriter) error {
+			serialized.Add(1)
+			return SerializeJson(model, w)
+		},
+	}
+	mx := newServerTestMux(t, svr, &WebSocketEndpoint[wsTestInput, wsTestMessage]{
+		Name:         "chat",
+		Pattern:      "/rooms/{room}",
+		Interceptors: []Interceptor{recordingInterceptor(&trace, "endpoint")},
+		Handler: func(ctx *Context, in wsTestInput, conn *WebSocketConn[wsTestMessage]) error {
+			for {
+				msg, err := conn.Read()
+				if err != nil {
+					return nil
+				}
+				msg.Seq++
+				msg.Text = in.Room + ": " + msg.Text
+				if err = conn.Write(msg); err != nil {
+					return err
+				}
+			}
+		},
+	})
+	ts := httptest.NewServer(mx)
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/rooms/"
+
+	ws, err := websocket.Dial(wsURL+"go", "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the interceptors run before upgrading
+	if !slices.Equal(trace, []string{"endpoint"}) {
+		t.Errorf("expected the interceptors to run before upgrading, got %v", trace)
+	}
+	for i := 0; i < 2; i++ {
+		if err = websocket.JSON.Send(ws, wsTestMessage{Seq: i, Text: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+		var reply wsTestMessage
+		if err = websocket.JSON.Receive(ws, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply != (wsTestMessage{Seq: i + 1, Text: "go: hello"}) {
+			t.Errorf("unexpected reply %+v", reply)
+		}
+	}
+	ws.Close()
+	if serialized.Load() != 2 {
+		t.Errorf("expected the messages to be serialized by the server serializer, got %d", serialized.Load())
+	}
+
+	// the upgrade is rejected from other origins
+	if _, err = websocket.Dial(wsURL+"go", "", "http://evil.example"); err == nil {
+		t.Error("expected the upgrade from another origin to fail")
+	}
+
+	for _, c := range []struct {
+		name   string
+		header map[string]string
+		status int
+	}{
+		{"plain request", nil, http.StatusBadRequest},
+		{"other origin", map[string]string{"Upgrade": "websocket", "Origin": "http://evil.example"}, http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/rooms/go", nil)
+		for k, v := range c.header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		// the recorder is not a hijacker, wrap it so that the origin is checked
+		mx.ServeHTTP(hijackableRecorder{w}, r)
+		if w.Code != c.status {
+			t.Errorf("%s: expected %d, got %d %s", c.name, c.status, w.Code, w.Body.String())
+		}
+		var p Problem
+		if err = json.Unmarshal(w.Body.Bytes(), &p); err != nil || p.Status != c.status {
+			t.Errorf("%s: expected a problem response, got %s", c.name, w.Body.String())
+		}
+	}
+}
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, http.ErrNotSupported
+}